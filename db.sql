@@ -46,3 +46,524 @@ CREATE TABLE public."transaction" (
     CONSTRAINT fk_transaction_category FOREIGN KEY (transaction_category_id) REFERENCES public.transaction_category (transaction_category_id)
 );
 
+
+-- Authorization holds
+ALTER TABLE public.accounts ADD held_balance int8 DEFAULT 0 NOT NULL;
+
+ALTER TABLE public."transaction"
+    ADD status varchar DEFAULT 'completed' NOT NULL,
+    ADD hold_amount int8 DEFAULT 0 NOT NULL,
+    ADD expires_at timestamp NULL;
+
+CREATE INDEX transaction_authorized_expires_idx ON public."transaction" (expires_at) WHERE status = 'authorized';
+
+-- Reversals and refunds
+ALTER TABLE public.auths ADD "role" varchar DEFAULT 'user' NOT NULL;
+
+ALTER TABLE public."transaction"
+    ADD related_transaction_id int8 NULL,
+    ADD refunded_amount int8 DEFAULT 0 NOT NULL,
+    ADD CONSTRAINT fk_transaction_related FOREIGN KEY (related_transaction_id) REFERENCES public."transaction" (transaction_id);
+
+-- Scheduled and recurring transfers
+CREATE TABLE public.scheduled_transfers (
+    scheduled_transfer_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    to_account_id int8 NOT NULL,
+    transaction_category_id int8 NULL,
+    amount int8 NOT NULL,
+    frequency varchar NOT NULL,
+    start_at timestamp NOT NULL,
+    end_date timestamp NULL,
+    max_occurrences int4 NULL,
+    occurrences int4 DEFAULT 0 NOT NULL,
+    retry_count int4 DEFAULT 0 NOT NULL,
+    next_run_at timestamp NULL,
+    status varchar DEFAULT 'active' NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT scheduled_transfers_pk PRIMARY KEY (scheduled_transfer_id),
+    CONSTRAINT scheduled_transfers_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT scheduled_transfers_to_account_fk FOREIGN KEY (to_account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE INDEX scheduled_transfers_due_idx ON public.scheduled_transfers (next_run_at) WHERE status = 'active';
+
+CREATE TABLE public.scheduled_transfer_executions (
+    execution_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    scheduled_transfer_id int8 NOT NULL,
+    transaction_id int8 NULL,
+    occurrence int4 NOT NULL,
+    attempt int4 NOT NULL,
+    status varchar NOT NULL,
+    error varchar NULL,
+    executed_at timestamp NOT NULL,
+    CONSTRAINT scheduled_transfer_executions_pk PRIMARY KEY (execution_id),
+    CONSTRAINT scheduled_transfer_executions_schedule_fk FOREIGN KEY (scheduled_transfer_id) REFERENCES public.scheduled_transfers (scheduled_transfer_id)
+);
+
+-- Batch transfers
+CREATE TABLE public.transfer_batches (
+    batch_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    "mode" varchar NOT NULL,
+    status varchar NOT NULL,
+    total_items int4 DEFAULT 0 NOT NULL,
+    succeeded_items int4 DEFAULT 0 NOT NULL,
+    failed_items int4 DEFAULT 0 NOT NULL,
+    total_amount int8 DEFAULT 0 NOT NULL,
+    succeeded_amount int8 DEFAULT 0 NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    completed_at timestamp NULL,
+    CONSTRAINT transfer_batches_pk PRIMARY KEY (batch_id),
+    CONSTRAINT transfer_batches_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.transfer_batch_items (
+    item_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    batch_id int8 NOT NULL,
+    line int4 NOT NULL,
+    to_account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    transaction_category_id int8 NULL,
+    status varchar NOT NULL,
+    error varchar NULL,
+    transaction_id int8 NULL,
+    CONSTRAINT transfer_batch_items_pk PRIMARY KEY (item_id),
+    CONSTRAINT transfer_batch_items_batch_fk FOREIGN KEY (batch_id) REFERENCES public.transfer_batches (batch_id)
+);
+
+-- Saved beneficiaries
+CREATE TABLE public.beneficiaries (
+    beneficiary_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    target_account_id int8 NOT NULL,
+    nickname varchar NOT NULL,
+    verified_name varchar NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT beneficiaries_pk PRIMARY KEY (beneficiary_id),
+    CONSTRAINT beneficiaries_unique UNIQUE (account_id, target_account_id),
+    CONSTRAINT beneficiaries_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT beneficiaries_target_fk FOREIGN KEY (target_account_id) REFERENCES public.accounts (account_id)
+);
+
+-- Payment requests
+CREATE TABLE public.payment_requests (
+    payment_request_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    requester_account_id int8 NOT NULL,
+    payer_account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    note varchar NULL,
+    status varchar DEFAULT 'pending' NOT NULL,
+    transaction_id int8 NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    responded_at timestamp NULL,
+    CONSTRAINT payment_requests_pk PRIMARY KEY (payment_request_id),
+    CONSTRAINT payment_requests_requester_fk FOREIGN KEY (requester_account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT payment_requests_payer_fk FOREIGN KEY (payer_account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE INDEX payment_requests_pending_idx ON public.payment_requests (expires_at) WHERE status = 'pending';
+
+-- Split-bill groups
+CREATE TABLE public.bill_groups (
+    bill_group_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    "name" varchar NOT NULL,
+    created_by_account_id int8 NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT bill_groups_pk PRIMARY KEY (bill_group_id),
+    CONSTRAINT bill_groups_account_fk FOREIGN KEY (created_by_account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.bill_group_members (
+    bill_group_id int8 NOT NULL,
+    account_id int8 NOT NULL,
+    status varchar DEFAULT 'invited' NOT NULL,
+    joined_at timestamp NULL,
+    CONSTRAINT bill_group_members_pk PRIMARY KEY (bill_group_id, account_id),
+    CONSTRAINT bill_group_members_group_fk FOREIGN KEY (bill_group_id) REFERENCES public.bill_groups (bill_group_id),
+    CONSTRAINT bill_group_members_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.bill_expenses (
+    bill_expense_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    bill_group_id int8 NOT NULL,
+    paid_by_account_id int8 NOT NULL,
+    description varchar NULL,
+    amount int8 NOT NULL,
+    split_type varchar NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT bill_expenses_pk PRIMARY KEY (bill_expense_id),
+    CONSTRAINT bill_expenses_group_fk FOREIGN KEY (bill_group_id) REFERENCES public.bill_groups (bill_group_id)
+);
+
+CREATE TABLE public.bill_expense_shares (
+    bill_expense_id int8 NOT NULL,
+    account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    CONSTRAINT bill_expense_shares_pk PRIMARY KEY (bill_expense_id, account_id),
+    CONSTRAINT bill_expense_shares_expense_fk FOREIGN KEY (bill_expense_id) REFERENCES public.bill_expenses (bill_expense_id)
+);
+
+CREATE TABLE public.bill_settlements (
+    bill_settlement_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    bill_group_id int8 NOT NULL,
+    from_account_id int8 NOT NULL,
+    to_account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    transaction_id int8 NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT bill_settlements_pk PRIMARY KEY (bill_settlement_id),
+    CONSTRAINT bill_settlements_group_fk FOREIGN KEY (bill_group_id) REFERENCES public.bill_groups (bill_group_id),
+    CONSTRAINT bill_settlements_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id)
+);
+
+-- Savings pockets
+CREATE TABLE public.pockets (
+    pocket_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    "name" varchar NOT NULL,
+    balance int8 DEFAULT 0 NOT NULL,
+    target_amount int8 NULL,
+    target_date timestamp NULL,
+    auto_save_type varchar DEFAULT '' NOT NULL,
+    auto_save_amount int8 DEFAULT 0 NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    closed_at timestamp NULL,
+    CONSTRAINT pockets_pk PRIMARY KEY (pocket_id),
+    CONSTRAINT pockets_balance_check CHECK (balance >= 0),
+    CONSTRAINT pockets_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+-- Moves between the main balance and a pocket are recorded as transactions
+-- with only one side of the account set
+ALTER TABLE public."transaction"
+    ADD pocket_id int8 NULL,
+    ADD CONSTRAINT fk_transaction_pocket FOREIGN KEY (pocket_id) REFERENCES public.pockets (pocket_id);
+
+-- Interest accrual
+CREATE TABLE public.account_products (
+    product_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    "name" varchar NOT NULL,
+    day_count varchar DEFAULT 'ACT/365' NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT account_products_pk PRIMARY KEY (product_id)
+);
+
+CREATE TABLE public.product_rate_tiers (
+    tier_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    product_id int8 NOT NULL,
+    min_balance int8 DEFAULT 0 NOT NULL,
+    annual_rate numeric(9, 4) NOT NULL,
+    CONSTRAINT product_rate_tiers_pk PRIMARY KEY (tier_id),
+    CONSTRAINT product_rate_tiers_unique UNIQUE (product_id, min_balance),
+    CONSTRAINT product_rate_tiers_product_fk FOREIGN KEY (product_id) REFERENCES public.account_products (product_id)
+);
+
+ALTER TABLE public.accounts
+    ADD product_id int8 NULL,
+    ADD accrued_interest numeric(20, 6) DEFAULT 0 NOT NULL,
+    ADD CONSTRAINT accounts_product_fk FOREIGN KEY (product_id) REFERENCES public.account_products (product_id);
+
+CREATE TABLE public.interest_accruals (
+    accrual_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    accrual_date date NOT NULL,
+    balance int8 NOT NULL,
+    amount numeric(20, 6) NOT NULL,
+    transaction_id int8 NULL,
+    CONSTRAINT interest_accruals_pk PRIMARY KEY (accrual_id),
+    CONSTRAINT interest_accruals_unique UNIQUE (account_id, accrual_date),
+    CONSTRAINT interest_accruals_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+INSERT INTO public.transaction_categories ("name") VALUES ('Interest');
+
+-- Fee engine
+ALTER TABLE public.accounts ADD tier varchar DEFAULT 'basic' NOT NULL;
+
+CREATE TABLE public.fee_rules (
+    fee_rule_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    operation varchar NOT NULL,
+    tier varchar NOT NULL,
+    flat_fee int8 DEFAULT 0 NOT NULL,
+    "percent" numeric(9, 4) DEFAULT 0 NOT NULL,
+    min_fee int8 DEFAULT 0 NOT NULL,
+    max_fee int8 NULL,
+    free_per_month int4 DEFAULT 0 NOT NULL,
+    revenue_account_id int8 NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT fee_rules_pk PRIMARY KEY (fee_rule_id),
+    CONSTRAINT fee_rules_unique UNIQUE (operation, tier),
+    CONSTRAINT fee_rules_revenue_fk FOREIGN KEY (revenue_account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.fee_usages (
+    account_id int8 NOT NULL,
+    operation varchar NOT NULL,
+    "period" varchar NOT NULL,
+    count int4 DEFAULT 0 NOT NULL,
+    CONSTRAINT fee_usages_pk PRIMARY KEY (account_id, operation, "period")
+);
+
+INSERT INTO public.transaction_categories ("name") VALUES ('Fee');
+
+-- Transfer quotes
+CREATE TABLE public.used_transfer_quotes (
+    quote_id varchar NOT NULL,
+    account_id int8 NOT NULL,
+    transaction_id int8 NOT NULL,
+    used_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT used_transfer_quotes_pk PRIMARY KEY (quote_id)
+);
+
+-- Cash withdrawal and deposit
+ALTER TABLE public."transaction" ADD "type" varchar DEFAULT '' NOT NULL;
+
+ALTER TABLE public.accounts ADD is_agent bool DEFAULT false NOT NULL;
+
+CREATE TABLE public.cash_withdrawals (
+    cash_withdrawal_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    code_hash varchar NOT NULL,
+    status varchar NOT NULL,
+    agent_account_id int8 NULL,
+    transaction_id int8 NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    redeemed_at timestamp NULL,
+    CONSTRAINT cash_withdrawals_pk PRIMARY KEY (cash_withdrawal_id),
+    CONSTRAINT cash_withdrawals_code_unique UNIQUE (code_hash),
+    CONSTRAINT cash_withdrawals_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT cash_withdrawals_agent_fk FOREIGN KEY (agent_account_id) REFERENCES public.accounts (account_id)
+);
+
+-- External transfers
+CREATE TABLE public.external_transfers (
+    external_transfer_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    bank_code varchar NOT NULL,
+    account_number varchar NOT NULL,
+    account_name varchar NOT NULL,
+    amount int8 NOT NULL,
+    status varchar NOT NULL,
+    rail_reference varchar DEFAULT '' NOT NULL,
+    failure_reason varchar DEFAULT '' NOT NULL,
+    transaction_id int8 NOT NULL,
+    settlement_transaction_id int8 NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    updated_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT external_transfers_pk PRIMARY KEY (external_transfer_id),
+    CONSTRAINT external_transfers_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT external_transfers_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id)
+);
+
+CREATE INDEX external_transfers_pending_idx ON public.external_transfers (created_at) WHERE status = 'pending';
+
+-- Top-up through the payment gateway
+CREATE TABLE public.top_up_intents (
+    top_up_intent_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    amount int8 NOT NULL,
+    status varchar NOT NULL,
+    checkout_reference varchar DEFAULT '' NOT NULL,
+    checkout_url varchar DEFAULT '' NOT NULL,
+    transaction_id int8 NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp DEFAULT now() NOT NULL,
+    paid_at timestamp NULL,
+    CONSTRAINT top_up_intents_pk PRIMARY KEY (top_up_intent_id),
+    CONSTRAINT top_up_intents_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT top_up_intents_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id)
+);
+
+CREATE INDEX top_up_intents_reference_idx ON public.top_up_intents (checkout_reference);
+
+CREATE TABLE public.gateway_events (
+    event_id varchar NOT NULL,
+    "type" varchar NOT NULL,
+    received_at timestamp DEFAULT now() NOT NULL,
+    CONSTRAINT gateway_events_pk PRIMARY KEY (event_id)
+);
+
+-- Timezone-aware timestamps. Existing values were written in Asia/Jakarta
+-- local time, see the TimeZone of the connection string.
+ALTER TABLE public."transaction"
+    ALTER COLUMN transaction_date TYPE timestamptz USING transaction_date AT TIME ZONE 'Asia/Jakarta',
+    ALTER COLUMN expires_at TYPE timestamptz USING expires_at AT TIME ZONE 'Asia/Jakarta';
+
+ALTER TABLE public.accounts ADD timezone varchar DEFAULT 'Asia/Jakarta' NOT NULL;
+
+-- Monthly statements
+CREATE TABLE public.statements (
+    statement_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    statement_number varchar NOT NULL,
+    "period" varchar NOT NULL,
+    period_start timestamptz NOT NULL,
+    period_end timestamptz NOT NULL,
+    opening_balance int8 NOT NULL,
+    closing_balance int8 NOT NULL,
+    total_in int8 NOT NULL,
+    total_out int8 NOT NULL,
+    "content" bytea NOT NULL,
+    created_at timestamptz DEFAULT now() NOT NULL,
+    CONSTRAINT statements_pk PRIMARY KEY (statement_id),
+    CONSTRAINT statements_number_unique UNIQUE (statement_number),
+    CONSTRAINT statements_period_unique UNIQUE (account_id, "period"),
+    CONSTRAINT statements_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+-- History imported from CSV
+CREATE TABLE public.imported_transactions (
+    account_id int8 NOT NULL,
+    fingerprint varchar NOT NULL,
+    transaction_id int8 NOT NULL,
+    imported_at timestamptz DEFAULT now() NOT NULL,
+    CONSTRAINT imported_transactions_pk PRIMARY KEY (account_id, fingerprint),
+    CONSTRAINT imported_transactions_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id),
+    CONSTRAINT imported_transactions_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id)
+);
+
+-- Free-text description, searched together with the counterparty and
+-- category names
+ALTER TABLE public."transaction" ADD description varchar DEFAULT '' NOT NULL;
+
+-- Notes, tags and receipts, private to the account that added them
+CREATE TABLE public.tags (
+    tag_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    account_id int8 NOT NULL,
+    "name" varchar NOT NULL,
+    CONSTRAINT tags_pk PRIMARY KEY (tag_id),
+    CONSTRAINT tags_name_unique UNIQUE (account_id, "name"),
+    CONSTRAINT tags_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.transaction_tags (
+    transaction_id int8 NOT NULL,
+    tag_id int8 NOT NULL,
+    CONSTRAINT transaction_tags_pk PRIMARY KEY (transaction_id, tag_id),
+    CONSTRAINT transaction_tags_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id),
+    CONSTRAINT transaction_tags_tag_fk FOREIGN KEY (tag_id) REFERENCES public.tags (tag_id) ON DELETE CASCADE
+);
+
+CREATE TABLE public.transaction_notes (
+    transaction_id int8 NOT NULL,
+    account_id int8 NOT NULL,
+    note varchar NOT NULL,
+    updated_at timestamptz DEFAULT now() NOT NULL,
+    CONSTRAINT transaction_notes_pk PRIMARY KEY (transaction_id, account_id),
+    CONSTRAINT transaction_notes_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id),
+    CONSTRAINT transaction_notes_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE TABLE public.attachments (
+    attachment_id int8 GENERATED ALWAYS AS IDENTITY NOT NULL,
+    transaction_id int8 NOT NULL,
+    account_id int8 NOT NULL,
+    file_name varchar NOT NULL,
+    content_type varchar NOT NULL,
+    "size" int8 NOT NULL,
+    storage_key varchar NOT NULL,
+    created_at timestamptz DEFAULT now() NOT NULL,
+    CONSTRAINT attachments_pk PRIMARY KEY (attachment_id),
+    CONSTRAINT attachments_transaction_fk FOREIGN KEY (transaction_id) REFERENCES public."transaction" (transaction_id),
+    CONSTRAINT attachments_account_fk FOREIGN KEY (account_id) REFERENCES public.accounts (account_id)
+);
+
+CREATE INDEX attachments_transaction_idx ON public.attachments (transaction_id, account_id);
+
+-- Every transaction is typed. Older rows get the type their columns imply.
+UPDATE public."transaction" t SET "type" = CASE
+        WHEN c."name" = 'Fee' THEN 'fee'
+        WHEN c."name" = 'Interest' THEN 'interest'
+        WHEN t.related_transaction_id IS NOT NULL THEN 'reversal'
+        WHEN t.pocket_id IS NOT NULL THEN 'pocket'
+        WHEN t.from_account_id IS NOT NULL AND t.to_account_id IS NOT NULL THEN 'transfer'
+        WHEN t.to_account_id IS NOT NULL THEN 'topup'
+        WHEN t.from_account_id IS NOT NULL THEN 'withdrawal'
+        ELSE 'adjustment'
+    END
+FROM public."transaction" src
+LEFT JOIN public.transaction_categories c ON c.transaction_category_id = src.transaction_category_id
+WHERE src.transaction_id = t.transaction_id AND t."type" = '';
+
+ALTER TABLE public."transaction"
+    ALTER COLUMN "type" DROP DEFAULT,
+    ADD CONSTRAINT transaction_type_check CHECK ("type" IN ('topup', 'transfer', 'fee', 'interest', 'reversal', 'adjustment', 'withdrawal', 'deposit', 'external_transfer', 'import', 'pocket')),
+    ADD CONSTRAINT transaction_status_check CHECK (status IN ('completed', 'authorized', 'captured', 'voided', 'expired'));
+
+-- Holds that reserved money through the hold endpoint. Only those can be
+-- captured, voided or expired.
+ALTER TABLE public."transaction" ADD funds_held bool DEFAULT false NOT NULL;
+UPDATE public."transaction" SET funds_held = true WHERE status = 'authorized' AND hold_amount > 0;
+
+-- Opening date of accounts, so no statement is made for a month before it.
+-- Older accounts count as opened at their first posting.
+ALTER TABLE public.accounts ADD created_at timestamptz NULL;
+UPDATE public.accounts a SET created_at = COALESCE(
+    (SELECT min(t.transaction_date) FROM public."transaction" t
+     WHERE a.account_id IN (t.account_id, t.from_account_id, t.to_account_id)),
+    '1970-01-01');
+ALTER TABLE public.accounts
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL;
+
+-- Search index. search_vector holds the description and the names of the
+-- category and of both accounts, a superset of the document an account
+-- searches, so it can narrow the candidates down through the index.
+ALTER TABLE public."transaction" ADD search_vector tsvector DEFAULT ''::tsvector NOT NULL;
+
+CREATE FUNCTION public.transaction_search_vector(t public."transaction") RETURNS tsvector AS $$
+    SELECT to_tsvector('simple', concat_ws(' ', t.description,
+        (SELECT name FROM public.transaction_categories WHERE transaction_category_id = t.transaction_category_id),
+        (SELECT name FROM public.accounts WHERE account_id = t.from_account_id),
+        (SELECT name FROM public.accounts WHERE account_id = t.to_account_id)))
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION public.transaction_search_vector_fill() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := public.transaction_search_vector(NEW);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transaction_search_vector_fill
+    BEFORE INSERT OR UPDATE OF description, transaction_category_id, from_account_id, to_account_id ON public."transaction"
+    FOR EACH ROW EXECUTE FUNCTION public.transaction_search_vector_fill();
+
+-- Renamed accounts and categories are found under their new name
+CREATE FUNCTION public.account_search_vector_refresh() RETURNS trigger AS $$
+BEGIN
+    UPDATE public."transaction" t SET search_vector = public.transaction_search_vector(t)
+    WHERE NEW.account_id IN (t.from_account_id, t.to_account_id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER account_search_vector_refresh
+    AFTER UPDATE OF name ON public.accounts
+    FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+    EXECUTE FUNCTION public.account_search_vector_refresh();
+
+CREATE FUNCTION public.category_search_vector_refresh() RETURNS trigger AS $$
+BEGIN
+    UPDATE public."transaction" t SET search_vector = public.transaction_search_vector(t)
+    WHERE t.transaction_category_id = NEW.transaction_category_id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER category_search_vector_refresh
+    AFTER UPDATE OF name ON public.transaction_categories
+    FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+    EXECUTE FUNCTION public.category_search_vector_refresh();
+
+UPDATE public."transaction" t SET search_vector = public.transaction_search_vector(t);
+
+CREATE INDEX transaction_search_idx ON public."transaction" USING gin (search_vector);
+
+-- Interest is accrued from the day a product is assigned, catching up on
+-- days the job missed
+ALTER TABLE public.accounts ADD product_assigned_at timestamptz NULL;
@@ -0,0 +1,179 @@
+package finformat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CAMT053Namespace is the version of camt.053 written by WriteCAMT053.
+const CAMT053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtDocument struct {
+	XMLName xml.Name `xml:"Document"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Report  struct {
+		Header struct {
+			MsgID   string `xml:"MsgId"`
+			CreDtTm string `xml:"CreDtTm"`
+		} `xml:"GrpHdr"`
+		Statement camtStatement `xml:"Stmt"`
+	} `xml:"BkToCstmrStmt"`
+}
+
+type camtStatement struct {
+	ID      string `xml:"Id"`
+	CreDtTm string `xml:"CreDtTm"`
+	FrToDt  struct {
+		From string `xml:"FrDtTm"`
+		To   string `xml:"ToDtTm"`
+	} `xml:"FrToDt"`
+	Account struct {
+		ID struct {
+			Other struct {
+				ID string `xml:"Id"`
+			} `xml:"Othr"`
+		} `xml:"Id"`
+		Currency string `xml:"Ccy"`
+		Name     string `xml:"Nm,omitempty"`
+	} `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Type struct {
+		Code string `xml:"CdOrPrtry>Cd"`
+	} `xml:"Tp"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+}
+
+type camtEntry struct {
+	Reference   string     `xml:"NtryRef"`
+	Amount      camtAmount `xml:"Amt"`
+	Indicator   string     `xml:"CdtDbtInd"`
+	Status      string     `xml:"Sts"`
+	BookingDate string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>Dt"`
+	BankCode    struct {
+		Code string `xml:"Prtry>Cd"`
+	} `xml:"BkTxCd"`
+	Details struct {
+		Transaction struct {
+			TxID         string          `xml:"Refs>TxId"`
+			RelatedParty *camtParties    `xml:"RltdPties,omitempty"`
+			Remittance   *camtRemittance `xml:"RmtInf,omitempty"`
+		} `xml:"TxDtls"`
+	} `xml:"NtryDtls"`
+}
+
+type camtRemittance struct {
+	Unstructured string `xml:"Ustrd"`
+}
+
+type camtParties struct {
+	Debtor   *camtParty `xml:"Dbtr,omitempty"`
+	Creditor *camtParty `xml:"Cdtr,omitempty"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm"`
+}
+
+// WriteCAMT053 writes s as an ISO 20022 camt.053.001.02 bank to customer
+// statement with opening and closing booked balances.
+func WriteCAMT053(w io.Writer, s Statement) error {
+	doc := camtDocument{Xmlns: CAMT053Namespace}
+
+	id := fmt.Sprintf("%s-%d-%s", BankID, s.AccountID, s.CreatedAt.UTC().Format("20060102150405"))
+	doc.Report.Header.MsgID = id
+	doc.Report.Header.CreDtTm = camtTime(s.CreatedAt)
+
+	stmt := &doc.Report.Statement
+	stmt.ID = id
+	stmt.CreDtTm = camtTime(s.CreatedAt)
+	stmt.FrToDt.From = camtTime(s.From)
+	stmt.FrToDt.To = camtTime(s.To)
+	stmt.Account.ID.Other.ID = strconv.FormatInt(s.AccountID, 10)
+	stmt.Account.Currency = s.Currency
+	stmt.Account.Name = truncate(s.AccountName, 70)
+
+	stmt.Balances = []camtBalance{
+		camtBalanceOf("OPBD", s.OpeningBalance, s.Currency, s.From),
+		camtBalanceOf("CLBD", s.ClosingBalance, s.Currency, s.To),
+	}
+
+	for _, entry := range s.Entries {
+		ntry := camtEntry{
+			Reference:   strconv.FormatInt(entry.ID, 10),
+			Amount:      camtAmount{Currency: s.Currency, Value: decimal(abs(entry.Amount))},
+			Indicator:   indicator(entry.Amount),
+			Status:      "BOOK",
+			BookingDate: camtTime(entry.Date),
+			ValueDate:   entry.Date.Format("2006-01-02"),
+		}
+		ntry.BankCode.Code = entry.Type
+		if ntry.BankCode.Code == "" {
+			ntry.BankCode.Code = "transfer"
+		}
+
+		details := &ntry.Details.Transaction
+		details.TxID = ntry.Reference
+		if entry.Category != "" {
+			details.Remittance = &camtRemittance{Unstructured: truncate(entry.Category, 140)}
+		}
+		if entry.Name != "" {
+			// The counterparty paid us on a credit and was paid on a debit
+			party := &camtParty{Name: truncate(entry.Name, 140)}
+			if entry.Amount < 0 {
+				details.RelatedParty = &camtParties{Creditor: party}
+			} else {
+				details.RelatedParty = &camtParties{Debtor: party}
+			}
+		}
+
+		stmt.Entries = append(stmt.Entries, ntry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func camtBalanceOf(code string, amount int64, currency string, at time.Time) camtBalance {
+	balance := camtBalance{
+		Amount:    camtAmount{Currency: currency, Value: decimal(abs(amount))},
+		Indicator: indicator(amount),
+		Date:      at.Format("2006-01-02"),
+	}
+	balance.Type.Code = code
+	return balance
+}
+
+// indicator is the sign of an amount; camt.053 amounts are never negative.
+func indicator(amount int64) string {
+	if amount < 0 {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func camtTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05-07:00")
+}
@@ -0,0 +1,100 @@
+package finformat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteCAMT053(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCAMT053(&buf, testStatement()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("parsing written camt.053: %v", err)
+	}
+	if doc.Xmlns != CAMT053Namespace {
+		t.Errorf("namespace = %q", doc.Xmlns)
+	}
+
+	stmt := doc.Report.Statement
+	if stmt.ID != "GODB-42-20261001010000" || doc.Report.Header.MsgID != stmt.ID {
+		t.Errorf("ids = %s, %s", doc.Report.Header.MsgID, stmt.ID)
+	}
+	if stmt.FrToDt.From != "2026-09-01T00:00:00+07:00" || stmt.FrToDt.To != "2026-09-30T23:59:59+07:00" {
+		t.Errorf("period = %+v", stmt.FrToDt)
+	}
+	if stmt.Account.ID.Other.ID != "42" || stmt.Account.Currency != "IDR" || stmt.Account.Name != "Budi Santoso" {
+		t.Errorf("account = %+v", stmt.Account)
+	}
+
+	if len(stmt.Balances) != 2 {
+		t.Fatalf("got %d balances, want 2", len(stmt.Balances))
+	}
+	for i, want := range []struct{ code, amount, indicator, date string }{
+		{"OPBD", "100000.00", "CRDT", "2026-09-01"},
+		{"CLBD", "125000.00", "CRDT", "2026-09-30"},
+	} {
+		got := stmt.Balances[i]
+		if got.Type.Code != want.code || got.Amount.Value != want.amount || got.Amount.Currency != "IDR" || got.Indicator != want.indicator || got.Date != want.date {
+			t.Errorf("balance %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if len(stmt.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(stmt.Entries))
+	}
+	credit, debit := stmt.Entries[0], stmt.Entries[1]
+	if credit.Reference != "7" || credit.Amount.Value != "50000.00" || credit.Indicator != "CRDT" || credit.Status != "BOOK" {
+		t.Errorf("credit = %+v", credit)
+	}
+	if credit.BookingDate != "2026-09-03T10:15:00+07:00" || credit.ValueDate != "2026-09-03" || credit.BankCode.Code != "topup" {
+		t.Errorf("credit dates = %s %s, code %s", credit.BookingDate, credit.ValueDate, credit.BankCode.Code)
+	}
+	if parties := credit.Details.Transaction.RelatedParty; parties == nil || parties.Debtor == nil || parties.Debtor.Name != "Gateway" || parties.Creditor != nil {
+		t.Errorf("credit parties = %+v", parties)
+	}
+	if debit.Amount.Value != "25000.00" || debit.Indicator != "DBIT" {
+		t.Errorf("debit = %+v", debit)
+	}
+	if parties := debit.Details.Transaction.RelatedParty; parties == nil || parties.Creditor == nil || parties.Creditor.Name != "Warung <Bu Siti> & Sons, Jalan Panjang" || parties.Debtor != nil {
+		t.Errorf("debit parties = %+v", parties)
+	}
+	if remittance := debit.Details.Transaction.Remittance; remittance == nil || remittance.Unstructured != "Food\nand drinks" {
+		t.Errorf("debit remittance = %+v", remittance)
+	}
+
+	assertOrder(t, data, "BkToCstmrStmt", "GrpHdr", "Stmt")
+	assertOrder(t, data, "Stmt", "Id", "CreDtTm", "FrToDt", "Acct", "Bal", "Bal", "Ntry", "Ntry")
+	assertOrder(t, data, "Bal", "Tp", "Amt", "CdtDbtInd", "Dt")
+	assertOrder(t, data, "Ntry", "NtryRef", "Amt", "CdtDbtInd", "Sts", "BookgDt", "ValDt", "BkTxCd", "NtryDtls")
+	assertOrder(t, data, "TxDtls", "Refs", "RltdPties", "RmtInf")
+}
+
+func TestWriteCAMT053NegativeBalance(t *testing.T) {
+	s := testStatement()
+	s.OpeningBalance = -500
+	s.Entries = []Entry{{ID: 1, Date: s.From, Amount: 500}}
+
+	var buf bytes.Buffer
+	if err := WriteCAMT053(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc camtDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("parsing written camt.053: %v", err)
+	}
+	opening := doc.Report.Statement.Balances[0]
+	if opening.Amount.Value != "500.00" || opening.Indicator != "DBIT" {
+		t.Errorf("opening balance = %+v", opening)
+	}
+	entry := doc.Report.Statement.Entries[0]
+	if entry.BankCode.Code != "transfer" || entry.Details.Transaction.RelatedParty != nil || entry.Details.Transaction.Remittance != nil {
+		t.Errorf("entry without details = %+v", entry)
+	}
+}
@@ -0,0 +1,56 @@
+// Package finformat writes account history in the formats personal finance
+// and accounting tools import: OFX, QIF and ISO 20022 camt.053.
+package finformat
+
+import (
+	"fmt"
+	"time"
+)
+
+// BankID identifies this bank in the exported files.
+const BankID = "GODB"
+
+// Statement is the history of one account between From and To.
+type Statement struct {
+	AccountID      int64
+	AccountName    string
+	Currency       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance int64
+	ClosingBalance int64
+	Entries        []Entry
+	CreatedAt      time.Time
+}
+
+// Entry is one posting. Amount is negative for money leaving the account.
+type Entry struct {
+	ID       int64
+	Date     time.Time
+	Amount   int64
+	Type     string
+	Name     string
+	Category string
+}
+
+// decimal renders a whole currency amount with two decimals, as all three
+// formats expect.
+func decimal(amount int64) string {
+	return fmt.Sprintf("%d.00", amount)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// truncate cuts s to at most n runes.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
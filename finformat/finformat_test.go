@@ -0,0 +1,89 @@
+package finformat
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jakarta = time.FixedZone("WIB", 7*60*60)
+
+// testStatement has a credit, a debit with characters that need escaping and
+// a name longer than OFX allows.
+func testStatement() Statement {
+	return Statement{
+		AccountID:      42,
+		AccountName:    "Budi Santoso",
+		Currency:       "IDR",
+		From:           time.Date(2026, 9, 1, 0, 0, 0, 0, jakarta),
+		To:             time.Date(2026, 9, 30, 23, 59, 59, 0, jakarta),
+		OpeningBalance: 100000,
+		ClosingBalance: 125000,
+		CreatedAt:      time.Date(2026, 10, 1, 8, 0, 0, 0, jakarta),
+		Entries: []Entry{
+			{ID: 7, Date: time.Date(2026, 9, 3, 10, 15, 0, 0, jakarta), Amount: 50000, Type: "topup", Name: "Gateway", Category: "Top up"},
+			{ID: 9, Date: time.Date(2026, 9, 12, 19, 30, 0, 0, jakarta), Amount: -25000, Type: "transfer", Name: "Warung <Bu Siti> & Sons, Jalan Panjang", Category: "Food\nand drinks"},
+		},
+	}
+}
+
+// childOrder returns the names of the direct children of the first parent
+// element in data, in document order.
+func childOrder(t *testing.T, data []byte, parent string) []string {
+	t.Helper()
+
+	dec := xml.NewDecoder(strings.NewReader(string(data)))
+	depth, parentDepth := 0, -1
+	names := []string{}
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if parentDepth < 0 && token.Name.Local == parent {
+				parentDepth = depth
+			} else if parentDepth > 0 && depth == parentDepth+1 {
+				names = append(names, token.Name.Local)
+			}
+		case xml.EndElement:
+			if depth == parentDepth {
+				return names
+			}
+			depth--
+		}
+	}
+	t.Fatalf("element %s not found", parent)
+	return nil
+}
+
+func assertOrder(t *testing.T, data []byte, parent string, want ...string) {
+	t.Helper()
+	if got := childOrder(t, data, parent); !reflect.DeepEqual(got, want) {
+		t.Errorf("children of %s = %v, want %v", parent, got, want)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for amount, want := range map[int64]string{0: "0.00", 1500: "1500.00", -25000: "-25000.00"} {
+		if got := decimal(amount); got != want {
+			t.Errorf("decimal(%d) = %q, want %q", amount, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("Kopi Kenangan", 4); got != "Kopi" {
+		t.Errorf("truncate = %q, want %q", got, "Kopi")
+	}
+	if got := truncate("日本語テキスト", 3); got != "日本語" {
+		t.Errorf("truncate = %q, want %q", got, "日本語")
+	}
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("truncate = %q, want %q", got, "short")
+	}
+}
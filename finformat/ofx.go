@@ -0,0 +1,114 @@
+package finformat
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	SignOn  struct {
+		Response struct {
+			Status   ofxStatus `xml:"STATUS"`
+			DTServer string    `xml:"DTSERVER"`
+			Language string    `xml:"LANGUAGE"`
+		} `xml:"SONRS"`
+	} `xml:"SIGNONMSGSRSV1"`
+	Bank struct {
+		Transaction struct {
+			TrnUID    string    `xml:"TRNUID"`
+			Status    ofxStatus `xml:"STATUS"`
+			Statement struct {
+				Currency string `xml:"CURDEF"`
+				Account  struct {
+					BankID   string `xml:"BANKID"`
+					AcctID   string `xml:"ACCTID"`
+					AcctType string `xml:"ACCTTYPE"`
+				} `xml:"BANKACCTFROM"`
+				List struct {
+					DTStart      string           `xml:"DTSTART"`
+					DTEnd        string           `xml:"DTEND"`
+					Transactions []ofxTransaction `xml:"STMTTRN"`
+				} `xml:"BANKTRANLIST"`
+				Ledger struct {
+					Amount string `xml:"BALAMT"`
+					AsOf   string `xml:"DTASOF"`
+				} `xml:"LEDGERBAL"`
+			} `xml:"STMTRS"`
+		} `xml:"STMTTRNRS"`
+	} `xml:"BANKMSGSRSV1"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxTransaction struct {
+	Type     string `xml:"TRNTYPE"`
+	DTPosted string `xml:"DTPOSTED"`
+	Amount   string `xml:"TRNAMT"`
+	FITID    string `xml:"FITID"`
+	Name     string `xml:"NAME,omitempty"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+// WriteOFX writes s as an OFX 2.2 bank statement response.
+func WriteOFX(w io.Writer, s Statement) error {
+	var doc ofxDocument
+	ok := ofxStatus{Code: 0, Severity: "INFO"}
+
+	doc.SignOn.Response.Status = ok
+	doc.SignOn.Response.DTServer = ofxTime(s.CreatedAt)
+	doc.SignOn.Response.Language = "ENG"
+
+	trn := &doc.Bank.Transaction
+	trn.TrnUID = "1"
+	trn.Status = ok
+
+	stmt := &trn.Statement
+	stmt.Currency = s.Currency
+	stmt.Account.BankID = BankID
+	stmt.Account.AcctID = strconv.FormatInt(s.AccountID, 10)
+	stmt.Account.AcctType = "CHECKING"
+	stmt.List.DTStart = ofxTime(s.From)
+	stmt.List.DTEnd = ofxTime(s.To)
+	for _, entry := range s.Entries {
+		kind := "CREDIT"
+		if entry.Amount < 0 {
+			kind = "DEBIT"
+		}
+		stmt.List.Transactions = append(stmt.List.Transactions, ofxTransaction{
+			Type:     kind,
+			DTPosted: ofxTime(entry.Date),
+			Amount:   decimal(entry.Amount),
+			FITID:    strconv.FormatInt(entry.ID, 10),
+			Name:     truncate(entry.Name, 32),
+			Memo:     truncate(entry.Category, 255),
+		})
+	}
+	stmt.Ledger.Amount = decimal(s.ClosingBalance)
+	stmt.Ledger.AsOf = ofxTime(s.To)
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ofxTime formats t in UTC with the explicit offset OFX allows.
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
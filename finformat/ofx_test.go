@@ -0,0 +1,75 @@
+package finformat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriteOFX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOFX(&buf, testStatement()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if !strings.HasPrefix(buf.String(), ofxHeader) {
+		t.Fatalf("missing OFX header:\n%s", buf.String())
+	}
+
+	var doc ofxDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("parsing written OFX: %v", err)
+	}
+
+	stmt := doc.Bank.Transaction.Statement
+	if stmt.Currency != "IDR" || stmt.Account.BankID != BankID || stmt.Account.AcctID != "42" {
+		t.Errorf("account = %s %+v", stmt.Currency, stmt.Account)
+	}
+	if stmt.List.DTStart != "20260831170000.000[0:GMT]" || stmt.List.DTEnd != "20260930165959.000[0:GMT]" {
+		t.Errorf("period = %s to %s", stmt.List.DTStart, stmt.List.DTEnd)
+	}
+	if stmt.Ledger.Amount != "125000.00" || stmt.Ledger.AsOf != stmt.List.DTEnd {
+		t.Errorf("ledger balance = %+v", stmt.Ledger)
+	}
+
+	want := []ofxTransaction{
+		{Type: "CREDIT", DTPosted: "20260903031500.000[0:GMT]", Amount: "50000.00", FITID: "7", Name: "Gateway", Memo: "Top up"},
+		{Type: "DEBIT", DTPosted: "20260912123000.000[0:GMT]", Amount: "-25000.00", FITID: "9", Name: "Warung <Bu Siti> & Sons, Jalan P", Memo: "Food\nand drinks"},
+	}
+	if len(stmt.List.Transactions) != len(want) {
+		t.Fatalf("got %d transactions, want %d", len(stmt.List.Transactions), len(want))
+	}
+	for i, got := range stmt.List.Transactions {
+		if got != want[i] {
+			t.Errorf("transaction %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	assertOrder(t, data, "OFX", "SIGNONMSGSRSV1", "BANKMSGSRSV1")
+	assertOrder(t, data, "STMTRS", "CURDEF", "BANKACCTFROM", "BANKTRANLIST", "LEDGERBAL")
+	assertOrder(t, data, "BANKTRANLIST", "DTSTART", "DTEND", "STMTTRN", "STMTTRN")
+	assertOrder(t, data, "STMTTRN", "TRNTYPE", "DTPOSTED", "TRNAMT", "FITID", "NAME", "MEMO")
+}
+
+func TestWriteOFXWithoutEntries(t *testing.T) {
+	s := testStatement()
+	s.Entries = nil
+
+	var buf bytes.Buffer
+	if err := WriteOFX(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc ofxDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("parsing written OFX: %v", err)
+	}
+	if n := len(doc.Bank.Transaction.Statement.List.Transactions); n != 0 {
+		t.Errorf("got %d transactions, want none", n)
+	}
+	if doc.Bank.Transaction.Statement.Ledger.Amount != "125000.00" {
+		t.Errorf("ledger balance = %s", doc.Bank.Transaction.Statement.Ledger.Amount)
+	}
+}
@@ -0,0 +1,36 @@
+package finformat
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// WriteQIF writes the entries of s as a QIF bank account list. QIF has no
+// notion of balances or currency, so only the entries are written.
+func WriteQIF(w io.Writer, s Statement) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("!Type:Bank\n")
+
+	for _, entry := range s.Entries {
+		b.WriteString("D" + entry.Date.Format("01/02/2006") + "\n")
+		b.WriteString("T" + decimal(entry.Amount) + "\n")
+		if entry.Name != "" {
+			b.WriteString("P" + qifLine(entry.Name) + "\n")
+		}
+		if entry.Type != "" {
+			b.WriteString("M" + qifLine(entry.Type) + "\n")
+		}
+		if entry.Category != "" {
+			b.WriteString("L" + qifLine(entry.Category) + "\n")
+		}
+		b.WriteString("^\n")
+	}
+
+	return b.Flush()
+}
+
+// qifLine keeps a value on one line, as every QIF field is a single line.
+func qifLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,76 @@
+package finformat
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseQIF splits a QIF file into its header and its records, each a map of
+// field code to value.
+func parseQIF(t *testing.T, data string) (string, []map[byte]string) {
+	t.Helper()
+
+	if !strings.HasSuffix(data, "\n") {
+		t.Fatalf("QIF does not end with a newline: %q", data)
+	}
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+
+	records := []map[byte]string{}
+	record := map[byte]string{}
+	for _, line := range lines[1:] {
+		if line == "^" {
+			records = append(records, record)
+			record = map[byte]string{}
+			continue
+		}
+		if line == "" {
+			t.Fatalf("empty line in QIF:\n%s", data)
+		}
+		if _, ok := record[line[0]]; ok {
+			t.Fatalf("field %c repeated in one record:\n%s", line[0], data)
+		}
+		record[line[0]] = line[1:]
+	}
+	if len(record) > 0 {
+		t.Fatalf("last record is not terminated:\n%s", data)
+	}
+	return lines[0], records
+}
+
+func TestWriteQIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteQIF(&buf, testStatement()); err != nil {
+		t.Fatal(err)
+	}
+
+	header, records := parseQIF(t, buf.String())
+	if header != "!Type:Bank" {
+		t.Errorf("header = %q", header)
+	}
+
+	want := []map[byte]string{
+		{'D': "09/03/2026", 'T': "50000.00", 'P': "Gateway", 'M': "topup", 'L': "Top up"},
+		{'D': "09/12/2026", 'T': "-25000.00", 'P': "Warung <Bu Siti> & Sons, Jalan Panjang", 'M': "transfer", 'L': "Food and drinks"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
+
+func TestWriteQIFOmitsEmptyFields(t *testing.T) {
+	s := testStatement()
+	s.Entries = []Entry{{ID: 1, Date: s.From, Amount: 1000}}
+
+	var buf bytes.Buffer
+	if err := WriteQIF(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	_, records := parseQIF(t, buf.String())
+	want := []map[byte]string{{'D': "09/01/2026", 'T': "1000.00"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrUnknownCheckout = errors.New("unknown checkout reference")
+
+// Fake is an in-memory gateway for development and tests. Its checkouts are
+// paid by calling Pay, which sends a signed webhook to WebhookURL like the
+// real gateway would.
+type Fake struct {
+	Secret     []byte
+	WebhookURL string
+	Client     *http.Client
+
+	mu        sync.Mutex
+	checkouts map[string]int64
+}
+
+func NewFake(secret []byte, webhookURL string) *Fake {
+	return &Fake{
+		Secret:     secret,
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		checkouts:  map[string]int64{},
+	}
+}
+
+func (f *Fake) CreateCheckout(intentID, amount int64) (Checkout, error) {
+	id, err := randomID()
+	if err != nil {
+		return Checkout{}, err
+	}
+	reference := fmt.Sprintf("fake_%d_%s", intentID, id)
+
+	f.mu.Lock()
+	f.checkouts[reference] = amount
+	f.mu.Unlock()
+
+	return Checkout{
+		Reference: reference,
+		URL:       "/fake-gateway/pay/" + reference,
+	}, nil
+}
+
+// Pay completes a checkout, successfully or not, and delivers the webhook.
+func (f *Fake) Pay(reference string, success bool) (Event, error) {
+	f.mu.Lock()
+	amount, ok := f.checkouts[reference]
+	f.mu.Unlock()
+	if !ok {
+		return Event{}, ErrUnknownCheckout
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return Event{}, err
+	}
+	event := Event{ID: "evt_" + id, Type: EventPaymentSucceeded}
+	if !success {
+		event.Type = EventPaymentFailed
+	}
+	event.Data.Reference = reference
+	event.Data.Amount = amount
+
+	return event, f.Deliver(event)
+}
+
+// Deliver signs and sends event to WebhookURL. Sending the same event twice
+// is how a replayed webhook looks.
+func (f *Fake) Deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(f.Secret, time.Now(), body))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,102 @@
+// Package gateway talks to the payment gateway that collects top-ups: it
+// creates checkouts and verifies the signed webhooks the gateway sends back.
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "t=<unix seconds>,v1=<hex hmac>" where the HMAC is
+// computed over "<t>.<body>".
+const SignatureHeader = "X-Gateway-Signature"
+
+// Webhook event types
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleSignature   = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// Checkout is where the client pays for an intent.
+type Checkout struct {
+	Reference string
+	URL       string
+}
+
+// Gateway creates checkouts. The outcome of a checkout arrives later as a
+// webhook Event.
+type Gateway interface {
+	CreateCheckout(intentID, amount int64) (Checkout, error)
+}
+
+// Event is the body of a webhook.
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Reference string `json:"reference"`
+		Amount    int64  `json:"amount"`
+	} `json:"data"`
+}
+
+// Sign returns the signature header value for body sent at t.
+func Sign(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, mac(secret, timestamp, body))
+}
+
+// Verify checks header against body and that it was signed within tolerance
+// of now, so an intercepted webhook cannot be replayed later.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	if len(secret) == 0 {
+		return ErrInvalidSignature
+	}
+
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(mac(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrStaleSignature
+	}
+
+	return nil
+}
+
+func mac(secret []byte, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
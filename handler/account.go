@@ -4,32 +4,41 @@ import (
 	"fmt"
 	"godb/model"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// maxDescriptionLength is the most characters a transfer description has.
+const maxDescriptionLength = 255
+
 type AccountInterface interface {
 	Create(*gin.Context)
 	Read(*gin.Context)
 	Update(*gin.Context)
 	Delete(*gin.Context)
 	List(*gin.Context)
-	TopUp(*gin.Context)
 	Balance(*gin.Context)
 	My(*gin.Context)
 	Transfer(*gin.Context)
 	MutationList(*gin.Context)
+	Lookup(*gin.Context)
+	Preview(*gin.Context)
+	Export(*gin.Context)
+	Search(*gin.Context)
 }
 
 type accountImplement struct {
-	db *gorm.DB
+	db         *gorm.DB
+	signingKey []byte
 }
 
-func NewAccount(db *gorm.DB) AccountInterface {
+func NewAccount(db *gorm.DB, signingKey []byte) AccountInterface {
 	return &accountImplement{
-		db: db,
+		db:         db,
+		signingKey: signingKey,
 	}
 }
 
@@ -44,6 +53,26 @@ func (a *accountImplement) Create(c *gin.Context) {
 		return
 	}
 
+	// Money only enters through top-ups, funds can only be reserved through
+	// holds and interest only by the accrual job
+	payload.Balance = 0
+	payload.HeldBalance = 0
+	payload.ProductID = nil
+	payload.ProductAssignedAt = nil
+	payload.AccruedInterest = 0
+	payload.IsAgent = false
+	payload.Tier = model.TierBasic
+	payload.CreatedAt = time.Now()
+
+	if payload.Timezone != "" {
+		if _, err := time.LoadLocation(payload.Timezone); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown timezone",
+			})
+			return
+		}
+	}
+
 	// Create data
 	result := a.db.Create(&payload)
 	if result.Error != nil {
@@ -96,6 +125,9 @@ func (a *accountImplement) Update(c *gin.Context) {
 	}
 
 	id := c.Param("id")
+	if !canManageAccount(c, id) {
+		return
+	}
 
 	// Retrieve the existing account by ID
 	account := model.Account{}
@@ -118,13 +150,19 @@ func (a *accountImplement) Update(c *gin.Context) {
 		account.Name = payload.Name
 	}
 
-	// Check if Balance is provided and is a valid number
-	if payload.Balance != 0 {
-		account.Balance = payload.Balance
+	if payload.Timezone != "" {
+		if _, err := time.LoadLocation(payload.Timezone); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown timezone",
+			})
+			return
+		}
+		account.Timezone = payload.Timezone
 	}
 
-	// Save the updated account information in the database
-	if err := a.db.Save(&account).Error; err != nil {
+	// Save the updated account information in the database, leaving the
+	// balances to the ledger and the tier to SetTier
+	if err := a.db.Model(&account).Select("name", "timezone").Updates(&account).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update account",
 		})
@@ -140,6 +178,9 @@ func (a *accountImplement) Update(c *gin.Context) {
 
 func (a *accountImplement) Delete(c *gin.Context) {
 	id := c.Param("id")
+	if !canManageAccount(c, id) {
+		return
+	}
 
 	if err := a.db.Where("account_id = ?", id).Delete(&model.Account{}).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -162,6 +203,26 @@ func (a *accountImplement) Delete(c *gin.Context) {
 	})
 }
 
+// canManageAccount reports whether the current account may change the account
+// id, which is only itself unless it is an admin, writing an error response
+// when it may not.
+func canManageAccount(c *gin.Context, id string) bool {
+	accountID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid account id",
+		})
+		return false
+	}
+	if c.GetString("role") != model.RoleAdmin && accountID != c.GetInt64("account_id") {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Forbidden",
+		})
+		return false
+	}
+	return true
+}
+
 func (a *accountImplement) List(c *gin.Context) {
 	var accounts []model.Account
 
@@ -178,60 +239,21 @@ func (a *accountImplement) List(c *gin.Context) {
 	})
 }
 
-func (h *accountImplement) TopUp(c *gin.Context) {
-	var payload struct {
-		AccountID int64 `json:"account_id"`
-		Amount    int   `json:"amount"`
-	}
-
-	// Bind request body ke struct
-	err := c.ShouldBindJSON(&payload)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
-		return
-	}
-
-	if payload.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
-		return
-	}
-
-	var account model.Account
-	result := h.db.First(&account, "account_id = ?", payload.AccountID)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account", "details": result.Error.Error()})
-		return
-	}
-
-	fmt.Printf("Account balance before top-up: %v\n", account.Balance)
-	updateResult := h.db.Model(&model.Account{}).Where("account_id = ?", payload.AccountID).
-		Update("balance", gorm.Expr("balance + ?", payload.Amount))
-
-	if updateResult.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to top up balance", "details": updateResult.Error.Error()})
-		return
-	}
-
-	fmt.Printf("Account balance after top-up: %v\n", account.Balance+int64(payload.Amount))
-	c.JSON(http.StatusOK, gin.H{"message": "Balance topped up successfully"})
-}
-
-
 func (h *accountImplement) Balance(c *gin.Context) {
 	accountID := c.GetInt64("account_id") 
 
 	var account model.Account
-	err := h.db.Select("balance").Where("account_id = ?", accountID).First(&account).Error
+	err := h.db.Select("balance", "held_balance").Where("account_id = ?", accountID).First(&account).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve balance"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"balance": account.Balance})
+	c.JSON(http.StatusOK, gin.H{
+		"balance":   account.Balance,
+		"held":      account.HeldBalance,
+		"available": account.Balance - account.HeldBalance,
+	})
 }
 
 func (h *accountImplement) My(c *gin.Context) {
@@ -250,8 +272,11 @@ func (h *accountImplement) My(c *gin.Context) {
 func (h *accountImplement) Transfer(c *gin.Context) {
     var payload struct {
         ToAccountID     int64  `json:"to_account_id"`
+        BeneficiaryID   *int64 `json:"beneficiary_id"`
         Amount              int    `json:"amount"`
         TransactionCategoryID *int64 `json:"transaction_category_id"`
+        Quote           string `json:"quote"`
+        Description     string `json:"description"`
     }
 
 	err := c.ShouldBindJSON(&payload)
@@ -260,101 +285,120 @@ func (h *accountImplement) Transfer(c *gin.Context) {
 		return
 	}
 
-	if payload.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+	if len([]rune(payload.Description)) > maxDescriptionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Description cannot be longer than %d characters", maxDescriptionLength)})
 		return
 	}
 
 	currentAccountID := c.GetInt64("account_id")
-	var currentAccount model.Account
-	err = h.db.First(&currentAccount, "account_id = ?", currentAccountID).Error
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve current account"})
-		return
+
+	// A quote from Preview is executed exactly as quoted, fee included
+	var quoted *transferQuote
+	var quotedFee *int64
+	if payload.Quote != "" {
+		claims, err := h.parseQuote(payload.Quote, currentAccountID)
+		if err != nil {
+			transferError(c, err)
+			return
+		}
+		quoted = &claims
+		quotedFee = &claims.Fee
+		payload.ToAccountID = claims.ToAccountID
+		payload.BeneficiaryID = nil
+		payload.Amount = int(claims.Amount)
+		payload.TransactionCategoryID = claims.TransactionCategoryID
 	}
 
-	if currentAccount.Balance < int64(payload.Amount) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	// A saved beneficiary can be used instead of the raw target account
+	toAccountID, err := resolveBeneficiary(h.db, currentAccountID, payload.ToAccountID, payload.BeneficiaryID)
+	if err != nil {
+		transferError(c, err)
 		return
 	}
 
-	var targetAccount model.Account
-	err = h.db.First(&targetAccount, "account_id = ?", payload.ToAccountID).Error
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Target account not found"})
+	if _, err := planTransfer(h.db, currentAccountID, toAccountID, int64(payload.Amount), payload.TransactionCategoryID, quotedFee); err != nil {
+		transferError(c, err)
 		return
 	}
 
+	var quote feeQuote
 	err = h.db.Transaction(func(tx *gorm.DB) error {
-		err := tx.Model(&currentAccount).Update("balance", gorm.Expr("balance - ?", payload.Amount)).Error //minus from
+		// masukin ke table transaction
+		var transaction model.Transaction
+		transaction, quote, err = transferFundsQuoted(tx, currentAccountID, toAccountID, int64(payload.Amount), payload.TransactionCategoryID, quotedFee)
 		if err != nil {
 			return err
 		}
 
-		// Add target account
-		err = tx.Model(&targetAccount).Update("balance", gorm.Expr("balance + ?", payload.Amount)).Error
-		if err != nil {
-			return err
+		if payload.Description != "" {
+			if err := tx.Model(&transaction).Update("description", payload.Description).Error; err != nil {
+				return err
+			}
 		}
 
-		// masukin ke table transaction
-		transaction := model.Transaction{
-			AccountID: 			  &currentAccountID,		
-			FromAccountID:        &currentAccountID,
-			ToAccountID:          &payload.ToAccountID,
-			TransactionCategoryID: payload.TransactionCategoryID,  
-			Amount:               int64(payload.Amount),
-			TransactionDate:      time.Now(),
-		}
-		err = tx.Create(&transaction).Error
-		if err != nil {
-			return err
+		if quoted != nil {
+			return markQuoteUsed(tx, *quoted, transaction.TransactionID)
 		}
-
 		return nil
 	})
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete transfer"})
+		transferError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Transfer successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer successful", "fee": quote})
 }
 
+// MutationList pages through the money the current account moved, newest
+// first, with the filters of mutationQuery. Timestamps are rendered in the
+// timezone of the account.
 func (h *accountImplement) MutationList(c *gin.Context) {
-	accountID := c.GetInt64("account_id") 
-
-	startDate := c.DefaultQuery("start_date", "")
-	endDate := c.DefaultQuery("end_date", "")
-
-	var mutations []model.Transaction
+	accountID := c.GetInt64("account_id")
 
-	query := h.db.Where("from_account_id = ? OR to_account_id = ?", accountID, accountID)
+	loc, err := accountLocation(h.db, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
 
-	if startDate != "" {
-		startTime, err := time.Parse("2006-01-02", startDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
-			return
-		}
-		query = query.Where("transaction_date >= ?", startTime)
+	query, ok := mutationQuery(c, h.db, accountID, loc)
+	if !ok {
+		return
 	}
 
-	if endDate != "" {
-		endTime, err := time.Parse("2006-01-02", endDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
-			return
-		}
-		query = query.Where("transaction_date <= ?", endTime)
+	transactions, next, limit, ok := transactionPage(c, query)
+	if !ok {
+		return
 	}
 
-	if err := query.Order("transaction_date desc").Limit(10).Find(&mutations).Error; err != nil {
+	mutations, err := enrichMutations(h.db, accountID, transactions, loc)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve mutations"})
 		return
 	}
 
-	c.JSON(http.StatusOK, mutations)
+	c.JSON(http.StatusOK, listEnvelope{Data: mutations, NextCursor: next, Limit: limit})
 }
 
+// Lookup returns the masked owner name of an account so the sender can
+// confirm the target before transferring.
+func (h *accountImplement) Lookup(c *gin.Context) {
+	id := c.Param("id")
+
+	var account model.Account
+	if err := h.db.Select("account_id", "name").First(&account, "account_id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"account_id":  account.AccountID,
+			"masked_name": maskName(account.Name),
+		},
+	})
+}
@@ -0,0 +1,471 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"godb/model"
+	"godb/storage"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxAttachmentSize = 5 << 20
+	maxAttachments    = 10
+	maxTags           = 20
+	maxTagLength      = 50
+	maxNoteLength     = 2000
+)
+
+// attachmentTypes are the accepted receipt formats, sniffed from the content
+// rather than trusted from the upload.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"application/pdf": true,
+}
+
+type AnnotationInterface interface {
+	Read(*gin.Context)
+	SetNote(*gin.Context)
+	SetTags(*gin.Context)
+	Tags(*gin.Context)
+	Upload(*gin.Context)
+	Attachments(*gin.Context)
+	Download(*gin.Context)
+	DeleteAttachment(*gin.Context)
+}
+
+type annotationImplement struct {
+	db    *gorm.DB
+	blobs storage.BlobStore
+}
+
+func NewAnnotation(db *gorm.DB, blobs storage.BlobStore) AnnotationInterface {
+	return &annotationImplement{
+		db:    db,
+		blobs: blobs,
+	}
+}
+
+// Read returns the note, tags and attachments the current account added to
+// a transaction.
+func (a *annotationImplement) Read(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	transaction, ok := a.ownTransaction(c, accountID)
+	if !ok {
+		return
+	}
+
+	var note model.TransactionNote
+	err := a.db.Where("transaction_id = ? AND account_id = ?", transaction.TransactionID, accountID).Limit(1).Find(&note).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve note"})
+		return
+	}
+
+	tags, err := transactionTags(a.db, transaction.TransactionID, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	var attachments []model.Attachment
+	err = a.db.Where("transaction_id = ? AND account_id = ?", transaction.TransactionID, accountID).
+		Order("attachment_id").Find(&attachments).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"transaction_id": transaction.TransactionID,
+			"note":           note.Note,
+			"tags":           tags,
+			"attachments":    attachments,
+		},
+	})
+}
+
+// SetNote replaces the note of the current account on a transaction. An
+// empty note removes it.
+func (a *annotationImplement) SetNote(c *gin.Context) {
+	var payload struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	payload.Note = strings.TrimSpace(payload.Note)
+	if len([]rune(payload.Note)) > maxNoteLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Note cannot be longer than %d characters", maxNoteLength)})
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	transaction, ok := a.ownTransaction(c, accountID)
+	if !ok {
+		return
+	}
+
+	note := model.TransactionNote{
+		TransactionID: transaction.TransactionID,
+		AccountID:     accountID,
+		Note:          payload.Note,
+		UpdatedAt:     time.Now(),
+	}
+
+	var err error
+	if note.Note == "" {
+		err = a.db.Delete(&note).Error
+	} else {
+		err = a.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&note).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Note saved",
+		"data":    note,
+	})
+}
+
+// SetTags replaces the tags of the current account on a transaction,
+// creating the tags it has not used before.
+func (a *annotationImplement) SetTags(c *gin.Context) {
+	var payload struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range payload.Tags {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if len([]rune(name)) > maxTagLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tags cannot be longer than %d characters", maxTagLength)})
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) > maxTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A transaction cannot have more than %d tags", maxTags)})
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	transaction, ok := a.ownTransaction(c, accountID)
+	if !ok {
+		return
+	}
+
+	var tags []model.Tag
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("transaction_id = ? AND tag_id IN (?)", transaction.TransactionID,
+			tx.Model(&model.Tag{}).Select("tag_id").Where("account_id = ?", accountID)).
+			Delete(&model.TransactionTag{}).Error
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+
+		created := make([]model.Tag, len(names))
+		for i, name := range names {
+			created[i] = model.Tag{AccountID: accountID, Name: name}
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "account_id"}, {Name: "name"}},
+			DoNothing: true,
+		}).Create(&created).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("account_id = ? AND name IN ?", accountID, names).Order("name").Find(&tags).Error; err != nil {
+			return err
+		}
+		links := make([]model.TransactionTag, len(tags))
+		for i, tag := range tags {
+			links[i] = model.TransactionTag{TransactionID: transaction.TransactionID, TagID: tag.TagID}
+		}
+		return tx.Create(&links).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags"})
+		return
+	}
+
+	if tags == nil {
+		tags = []model.Tag{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tags saved",
+		"data":    tags,
+	})
+}
+
+// Tags lists every tag of the current account.
+func (a *annotationImplement) Tags(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var tags []model.Tag
+	if err := a.db.Where("account_id = ?", accountID).Order("name").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tags,
+	})
+}
+
+// Upload stores the multipart "file" as a receipt of a transaction. Only
+// JPEG, PNG and PDF files up to maxAttachmentSize are accepted.
+func (a *annotationImplement) Upload(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	transaction, ok := a.ownTransaction(c, accountID)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentSize+64<<10)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File cannot be larger than %d MB", maxAttachmentSize>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	if file.Size > maxAttachmentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File cannot be larger than %d MB", maxAttachmentSize>>20)})
+		return
+	}
+	if file.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !attachmentTypes[contentType] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only JPEG, PNG and PDF files are accepted"})
+		return
+	}
+
+	var count int64
+	err = a.db.Model(&model.Attachment{}).
+		Where("transaction_id = ? AND account_id = ?", transaction.TransactionID, accountID).
+		Count(&count).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachments"})
+		return
+	}
+	if count >= maxAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A transaction cannot have more than %d attachments", maxAttachments)})
+		return
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+	key := fmt.Sprintf("attachments/%d/%s", accountID, hex.EncodeToString(random))
+
+	if err := a.blobs.Put(key, io.MultiReader(bytes.NewReader(head), f)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+
+	attachment := model.Attachment{
+		TransactionID: transaction.TransactionID,
+		AccountID:     accountID,
+		FileName:      attachmentName(file.Filename),
+		ContentType:   contentType,
+		Size:          file.Size,
+		StorageKey:    key,
+		CreatedAt:     time.Now(),
+	}
+	if err := a.db.Create(&attachment).Error; err != nil {
+		if err := a.blobs.Delete(key); err != nil {
+			log.Printf("removing orphaned attachment %s failed: %v\n", key, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    attachment,
+	})
+}
+
+func (a *annotationImplement) Attachments(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	transaction, ok := a.ownTransaction(c, accountID)
+	if !ok {
+		return
+	}
+
+	var attachments []model.Attachment
+	err := a.db.Where("transaction_id = ? AND account_id = ?", transaction.TransactionID, accountID).
+		Order("attachment_id").Find(&attachments).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": attachments,
+	})
+}
+
+func (a *annotationImplement) Download(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	attachment, ok := a.ownAttachment(c, accountID)
+	if !ok {
+		return
+	}
+
+	blob, err := a.blobs.Get(attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachment"})
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, attachment.FileName))
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, blob, nil)
+}
+
+func (a *annotationImplement) DeleteAttachment(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	attachment, ok := a.ownAttachment(c, accountID)
+	if !ok {
+		return
+	}
+
+	if err := a.db.Delete(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	// The row is gone, so a leftover file is only wasted space
+	if err := a.blobs.Delete(attachment.StorageKey); err != nil {
+		log.Printf("removing attachment %s failed: %v\n", attachment.StorageKey, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": gin.H{
+			"attachment_id": attachment.AttachmentID,
+		},
+	})
+}
+
+// ownTransaction loads the transaction of the id path parameter when the
+// account sent or received it. When it returns false it already wrote the
+// error response.
+func (a *annotationImplement) ownTransaction(c *gin.Context, accountID int64) (model.Transaction, bool) {
+	var transaction model.Transaction
+	err := a.db.Select("transaction_id").
+		Where("transaction_id = ?", c.Param("id")).
+		Where("from_account_id = ? OR to_account_id = ? OR account_id = ?", accountID, accountID, accountID).
+		First(&transaction).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+			return transaction, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transaction"})
+		return transaction, false
+	}
+	return transaction, true
+}
+
+// ownAttachment loads the attachment_id path parameter of the transaction in
+// the id path parameter, when the account uploaded it.
+func (a *annotationImplement) ownAttachment(c *gin.Context, accountID int64) (model.Attachment, bool) {
+	var attachment model.Attachment
+	err := a.db.First(&attachment, "attachment_id = ? AND transaction_id = ? AND account_id = ?",
+		c.Param("attachment_id"), c.Param("id"), accountID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return attachment, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachment"})
+		return attachment, false
+	}
+	return attachment, true
+}
+
+func transactionTags(db *gorm.DB, transactionID, accountID int64) ([]model.Tag, error) {
+	tags := []model.Tag{}
+	err := db.Joins("JOIN transaction_tags tt ON tt.tag_id = tags.tag_id").
+		Where("tt.transaction_id = ? AND tags.account_id = ?", transactionID, accountID).
+		Order("tags.name").
+		Find(&tags).Error
+	return tags, err
+}
+
+// attachmentName keeps the base name of an upload, without characters that
+// would break the Content-Disposition header.
+func attachmentName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == '"' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
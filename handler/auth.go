@@ -101,6 +101,9 @@ type authUpsertPayload struct {
 	Password  string `json:"password"`
 }
 
+// Upsert creates the login of an account that has none yet. It never
+// replaces one: without a login there is no way to prove who owns the
+// account, so passwords are only changed through ChangePassword.
 func (a *authImplement) Upsert(c *gin.Context) {
 	payload := authUpsertPayload{}
 
@@ -145,15 +148,27 @@ func (a *authImplement) Upsert(c *gin.Context) {
 		Password:  string(hashed),
 	}
 
-	// Upsert auth data (Insert or Update if already exists)
+	// Insert auth data, leaving an existing login of the account untouched
 	result := a.db.Clauses(
 		clause.OnConflict{
-			DoUpdates: clause.AssignmentColumns([]string{"username", "password"}),
+			DoNothing: true,
 			Columns:   []clause.Column{{Name: "account_id"}},
 		}).Create(&auth)
 	if result.Error != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": result.Error.Error(),
+		if isUniqueViolation(result.Error) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Username already taken",
+			})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create login",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Account already has a login, use change-password",
 		})
 		return
 	}
@@ -174,6 +189,7 @@ func (a *authImplement) createJWT(auth *model.Auth) (string, error) {
 	claims["auth_id"] = auth.AuthID
 	claims["account_id"] = auth.AccountID
 	claims["username"] = auth.Username
+	claims["role"] = auth.Role
 	claims["exp"] = time.Now().Add(time.Hour * 72).Unix() 
 
 	tokenString, err := token.SignedString(a.signingKey)
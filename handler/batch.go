@@ -0,0 +1,472 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"godb/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBatchItems = 1000
+	maxBatchBytes = 1 << 20
+)
+
+var errBatchTooLarge = fmt.Errorf("batch cannot have more than %d items", maxBatchItems)
+
+type BatchInterface interface {
+	Create(*gin.Context)
+	Read(*gin.Context)
+}
+
+type batchImplement struct {
+	db *gorm.DB
+}
+
+func NewBatch(db *gorm.DB) BatchInterface {
+	return &batchImplement{
+		db: db,
+	}
+}
+
+type batchLine struct {
+	ToAccountID           int64  `json:"to_account_id"`
+	Amount                int64  `json:"amount"`
+	TransactionCategoryID *int64 `json:"transaction_category_id"`
+}
+
+// Create accepts either a JSON body {"mode": ..., "items": [...]} or a CSV
+// upload (raw text/csv body or a multipart "file") with the header
+// to_account_id,amount[,transaction_category_id] and the mode as a query
+// parameter. Every line is validated before any money moves.
+func (b *batchImplement) Create(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBytes)
+	mode, lines, err := parseBatch(c)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Batch cannot be larger than %d MB", maxBatchBytes>>20)})
+		return
+	case errors.Is(err, errBatchTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batch cannot have more than %d items", maxBatchItems)})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if mode == "" {
+		mode = model.BatchModeAllOrNothing
+	}
+	if mode != model.BatchModeAllOrNothing && mode != model.BatchModeBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be all_or_nothing or best_effort"})
+		return
+	}
+
+	if len(lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch has no items"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	lineErrors, err := b.validate(currentAccountID, lines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate batch"})
+		return
+	}
+
+	var total int64
+	for _, line := range lines {
+		total += line.Amount
+	}
+
+	if mode == model.BatchModeAllOrNothing {
+		if len(lineErrors) > 0 {
+			errs := []gin.H{}
+			for i := range lines {
+				if msg, ok := lineErrors[i]; ok {
+					errs = append(errs, gin.H{"line": i + 1, "error": msg})
+				}
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Batch has invalid items", "details": errs})
+			return
+		}
+
+		var account model.Account
+		if err := b.db.First(&account, "account_id = ?", currentAccountID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve current account"})
+			return
+		}
+		if account.Balance-account.HeldBalance < total {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+			return
+		}
+	}
+
+	batch := model.TransferBatch{
+		AccountID:   currentAccountID,
+		Mode:        mode,
+		Status:      model.BatchStatusProcessing,
+		TotalItems:  len(lines),
+		TotalAmount: total,
+		CreatedAt:   time.Now(),
+	}
+	for i, line := range lines {
+		item := model.TransferBatchItem{
+			Line:                  i + 1,
+			ToAccountID:           line.ToAccountID,
+			Amount:                line.Amount,
+			TransactionCategoryID: line.TransactionCategoryID,
+			Status:                model.BatchItemStatusPending,
+		}
+		if msg, ok := lineErrors[i]; ok {
+			item.Status = model.BatchItemStatusFailed
+			item.Error = msg
+		}
+		batch.Items = append(batch.Items, item)
+	}
+
+	if err := b.db.Create(&batch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create batch"})
+		return
+	}
+
+	if mode == model.BatchModeAllOrNothing {
+		err = b.runAllOrNothing(&batch)
+	} else {
+		err = b.runBestEffort(&batch)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process batch", "batch_id": batch.BatchID})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Batch processed",
+		"data":    batch,
+	})
+}
+
+func (b *batchImplement) Read(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var batch model.TransferBatch
+	err := b.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line")
+	}).First(&batch, "batch_id = ? AND account_id = ?", id, accountID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": batch,
+	})
+}
+
+// validate returns an error message per invalid line, keyed by line index.
+func (b *batchImplement) validate(accountID int64, lines []batchLine) (map[int]string, error) {
+	accountIDs := []int64{}
+	categoryIDs := []int64{}
+	for _, line := range lines {
+		accountIDs = append(accountIDs, line.ToAccountID)
+		if line.TransactionCategoryID != nil {
+			categoryIDs = append(categoryIDs, *line.TransactionCategoryID)
+		}
+	}
+
+	var existingAccounts []int64
+	err := b.db.Model(&model.Account{}).Where("account_id IN ?", accountIDs).
+		Pluck("account_id", &existingAccounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var existingCategories []int64
+	if len(categoryIDs) > 0 {
+		err = b.db.Model(&model.TransactionCategories{}).Where("transaction_category_id IN ?", categoryIDs).
+			Pluck("transaction_category_id", &existingCategories).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accounts := map[int64]bool{}
+	for _, id := range existingAccounts {
+		accounts[id] = true
+	}
+	categories := map[int64]bool{}
+	for _, id := range existingCategories {
+		categories[id] = true
+	}
+
+	lineErrors := map[int]string{}
+	for i, line := range lines {
+		switch {
+		case line.Amount <= 0:
+			lineErrors[i] = "Amount must be greater than 0"
+		case line.ToAccountID == accountID:
+			lineErrors[i] = "Cannot transfer to your own account"
+		case !accounts[line.ToAccountID]:
+			lineErrors[i] = "Target account not found"
+		case line.TransactionCategoryID != nil && !categories[*line.TransactionCategoryID]:
+			lineErrors[i] = "Transaction category not found"
+		}
+	}
+
+	return lineErrors, nil
+}
+
+// runAllOrNothing executes every item in one database transaction; the first
+// failure rolls all of them back.
+func (b *batchImplement) runAllOrNothing(batch *model.TransferBatch) error {
+	failedLine := -1
+	var failure error
+
+	err := b.db.Transaction(func(tx *gorm.DB) error {
+		for i := range batch.Items {
+			item := &batch.Items[i]
+			transaction, err := transferFunds(tx, batch.AccountID, item.ToAccountID, item.Amount, item.TransactionCategoryID)
+			if err != nil {
+				failedLine, failure = i, err
+				return err
+			}
+			item.Status = model.BatchItemStatusSuccess
+			item.TransactionID = &transaction.TransactionID
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		if failure == nil {
+			return err
+		}
+		for i := range batch.Items {
+			item := &batch.Items[i]
+			item.Status = model.BatchItemStatusFailed
+			item.TransactionID = nil
+			item.Error = "Batch rolled back"
+			if i == failedLine {
+				item.Error = batchErrorMessage(failure)
+			}
+			if err := b.db.Save(item).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return b.finish(batch)
+}
+
+// runBestEffort executes every valid item in its own database transaction.
+func (b *batchImplement) runBestEffort(batch *model.TransferBatch) error {
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		if item.Status != model.BatchItemStatusPending {
+			continue
+		}
+
+		err := b.db.Transaction(func(tx *gorm.DB) error {
+			transaction, err := transferFunds(tx, batch.AccountID, item.ToAccountID, item.Amount, item.TransactionCategoryID)
+			if err != nil {
+				return err
+			}
+			item.TransactionID = &transaction.TransactionID
+			return nil
+		})
+		if err != nil {
+			item.Status = model.BatchItemStatusFailed
+			item.Error = batchErrorMessage(err)
+			item.TransactionID = nil
+		} else {
+			item.Status = model.BatchItemStatusSuccess
+		}
+
+		if err := b.db.Save(item).Error; err != nil {
+			return err
+		}
+	}
+
+	return b.finish(batch)
+}
+
+// finish computes the totals and final status of a batch and saves them.
+func (b *batchImplement) finish(batch *model.TransferBatch) error {
+	batch.SucceededItems, batch.FailedItems, batch.SucceededAmount = 0, 0, 0
+	for _, item := range batch.Items {
+		if item.Status == model.BatchItemStatusSuccess {
+			batch.SucceededItems++
+			batch.SucceededAmount += item.Amount
+		} else {
+			batch.FailedItems++
+		}
+	}
+
+	switch {
+	case batch.FailedItems == 0:
+		batch.Status = model.BatchStatusCompleted
+	case batch.SucceededItems == 0:
+		batch.Status = model.BatchStatusFailed
+	default:
+		batch.Status = model.BatchStatusPartial
+	}
+	now := time.Now()
+	batch.CompletedAt = &now
+
+	return b.db.Omit("Items").Save(batch).Error
+}
+
+func batchErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		return "Insufficient balance"
+	case errors.Is(err, errTargetNotFound):
+		return "Target account not found"
+	case errors.Is(err, errCategoryNotFound):
+		return "Transaction category not found"
+	default:
+		return "Failed to complete transfer"
+	}
+}
+
+// batchItems decodes a JSON array of batch lines, stopping at the first line
+// past maxBatchItems instead of decoding the whole array.
+type batchItems []batchLine
+
+func (items *batchItems) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("items must be an array")
+	}
+
+	for decoder.More() {
+		if len(*items) == maxBatchItems {
+			return errBatchTooLarge
+		}
+		var line batchLine
+		if err := decoder.Decode(&line); err != nil {
+			return err
+		}
+		*items = append(*items, line)
+	}
+	return nil
+}
+
+// parseBatch reads the mode and the lines of a batch from the JSON or CSV
+// body. It fails with errBatchTooLarge as soon as there are more than
+// maxBatchItems lines.
+func parseBatch(c *gin.Context) (string, []batchLine, error) {
+	contentType := c.ContentType()
+
+	switch {
+	case contentType == "text/csv":
+		lines, err := parseBatchCSV(c.Request.Body)
+		return c.Query("mode"), lines, err
+	case contentType == "multipart/form-data":
+		file, err := c.FormFile("file")
+		if err != nil {
+			return "", nil, err
+		}
+		f, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+
+		lines, err := parseBatchCSV(f)
+		return c.DefaultPostForm("mode", c.Query("mode")), lines, err
+	default:
+		var payload struct {
+			Mode  string     `json:"mode"`
+			Items batchItems `json:"items"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			return "", nil, err
+		}
+		return payload.Mode, payload.Items, nil
+	}
+}
+
+func parseBatchCSV(r io.Reader) ([]batchLine, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	toColumn, ok := columns["to_account_id"]
+	if !ok {
+		return nil, errors.New("missing to_account_id column")
+	}
+	amountColumn, ok := columns["amount"]
+	if !ok {
+		return nil, errors.New("missing amount column")
+	}
+	categoryColumn, hasCategory := columns["transaction_category_id"]
+
+	lines := []batchLine{}
+	for lineNumber := 1; ; lineNumber++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var line batchLine
+		line.ToAccountID, err = strconv.ParseInt(strings.TrimSpace(record[toColumn]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid to_account_id", lineNumber)
+		}
+		line.Amount, err = strconv.ParseInt(strings.TrimSpace(record[amountColumn]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount", lineNumber)
+		}
+		if hasCategory && strings.TrimSpace(record[categoryColumn]) != "" {
+			categoryID, err := strconv.ParseInt(strings.TrimSpace(record[categoryColumn]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid transaction_category_id", lineNumber)
+			}
+			line.TransactionCategoryID = &categoryID
+		}
+
+		if len(lines) == maxBatchItems {
+			return nil, errBatchTooLarge
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
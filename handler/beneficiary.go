@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+type BeneficiaryInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Update(*gin.Context)
+	Delete(*gin.Context)
+}
+
+type beneficiaryImplement struct {
+	db *gorm.DB
+}
+
+func NewBeneficiary(db *gorm.DB) BeneficiaryInterface {
+	return &beneficiaryImplement{
+		db: db,
+	}
+}
+
+func (b *beneficiaryImplement) Create(c *gin.Context) {
+	var payload struct {
+		TargetAccountID int64  `json:"target_account_id"`
+		Nickname        string `json:"nickname"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	if payload.TargetAccountID == currentAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot save your own account as beneficiary"})
+		return
+	}
+
+	var target model.Account
+	if err := b.db.First(&target, "account_id = ?", payload.TargetAccountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	nickname := strings.TrimSpace(payload.Nickname)
+	if nickname == "" {
+		nickname = target.Name
+	}
+
+	beneficiary := model.Beneficiary{
+		AccountID:       currentAccountID,
+		TargetAccountID: target.AccountID,
+		Nickname:        nickname,
+		VerifiedName:    maskName(target.Name),
+		CreatedAt:       time.Now(),
+	}
+
+	if err := b.db.Create(&beneficiary).Error; err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Beneficiary already saved"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save beneficiary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    beneficiary,
+	})
+}
+
+func (b *beneficiaryImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var beneficiaries []model.Beneficiary
+	if err := b.db.Where("account_id = ?", accountID).Order("nickname").Find(&beneficiaries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve beneficiaries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": beneficiaries,
+	})
+}
+
+func (b *beneficiaryImplement) Update(c *gin.Context) {
+	var payload struct {
+		Nickname string `json:"nickname"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	nickname := strings.TrimSpace(payload.Nickname)
+	if nickname == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nickname is required"})
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var beneficiary model.Beneficiary
+	if err := b.db.First(&beneficiary, "beneficiary_id = ? AND account_id = ?", id, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	beneficiary.Nickname = nickname
+	if err := b.db.Save(&beneficiary).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update beneficiary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    beneficiary,
+	})
+}
+
+func (b *beneficiaryImplement) Delete(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	result := b.db.Where("beneficiary_id = ? AND account_id = ?", id, accountID).Delete(&model.Beneficiary{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": map[string]string{
+			"beneficiary_id": id,
+		},
+	})
+}
+
+// maskName hides all but the first letter of every word of a name, so
+// "Budi Santoso" becomes "B*** S******".
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		runes := []rune(word)
+		words[i] = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	}
+	return strings.Join(words, " ")
+}
+
+// isUniqueViolation reports whether err comes from a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,678 @@
+package handler
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"godb/model"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errNothingToSettle = errors.New("nothing to settle")
+	errSettleExceeded  = errors.New("settle amount exceeds the debt")
+)
+
+type BillGroupInterface interface {
+	Create(*gin.Context)
+	Read(*gin.Context)
+	List(*gin.Context)
+	AddMember(*gin.Context)
+	Join(*gin.Context)
+	AddExpense(*gin.Context)
+	Balance(*gin.Context)
+	Settle(*gin.Context)
+}
+
+type billGroupImplement struct {
+	db *gorm.DB
+}
+
+func NewBillGroup(db *gorm.DB) BillGroupInterface {
+	return &billGroupImplement{
+		db: db,
+	}
+}
+
+// memberBalance is positive when the member is owed money and negative when
+// the member owes money to the group.
+type memberBalance struct {
+	AccountID int64 `json:"account_id"`
+	Balance   int64 `json:"balance"`
+}
+
+// settleStep is one transfer of a settle-up plan.
+type settleStep struct {
+	FromAccountID int64 `json:"from_account_id"`
+	ToAccountID   int64 `json:"to_account_id"`
+	Amount        int64 `json:"amount"`
+}
+
+func (b *billGroupImplement) Create(c *gin.Context) {
+	var payload struct {
+		Name             string  `json:"name"`
+		MemberAccountIDs []int64 `json:"member_account_ids"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+
+	// The creator is always a member, everyone else is invited
+	seen := map[int64]bool{currentAccountID: true}
+	memberIDs := []int64{currentAccountID}
+	for _, id := range payload.MemberAccountIDs {
+		if !seen[id] {
+			seen[id] = true
+			memberIDs = append(memberIDs, id)
+		}
+	}
+
+	var count int64
+	if err := b.db.Model(&model.Account{}).Where("account_id IN ?", memberIDs).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if int(count) != len(memberIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member account not found"})
+		return
+	}
+
+	now := time.Now()
+	group := model.BillGroup{
+		Name:               name,
+		CreatedByAccountID: currentAccountID,
+		CreatedAt:          now,
+	}
+	group.Members = append(group.Members, model.BillGroupMember{
+		AccountID: currentAccountID,
+		Status:    model.MemberJoined,
+		JoinedAt:  &now,
+	})
+	for _, id := range memberIDs[1:] {
+		group.Members = append(group.Members, model.BillGroupMember{AccountID: id, Status: model.MemberInvited})
+	}
+
+	if err := b.db.Create(&group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    group,
+	})
+}
+
+func (b *billGroupImplement) Read(c *gin.Context) {
+	group, ok := b.memberGroup(c)
+	if !ok {
+		return
+	}
+
+	var expenses []model.BillExpense
+	err := b.db.Preload("Shares").
+		Where("bill_group_id = ?", group.BillGroupID).
+		Order("created_at desc").
+		Find(&expenses).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve expenses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"group":    group,
+			"expenses": expenses,
+		},
+	})
+}
+
+func (b *billGroupImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var groups []model.BillGroup
+	err := b.db.Preload("Members").
+		Where("bill_group_id IN (?)", b.db.Model(&model.BillGroupMember{}).Select("bill_group_id").Where("account_id = ?", accountID)).
+		Order("created_at desc").
+		Find(&groups).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": groups,
+	})
+}
+
+// AddMember invites an account to the group. The account only becomes a
+// member once it accepts the invitation with Join.
+func (b *billGroupImplement) AddMember(c *gin.Context) {
+	var payload struct {
+		AccountID int64 `json:"account_id"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	group, ok := b.memberGroup(c)
+	if !ok {
+		return
+	}
+
+	var account model.Account
+	if err := b.db.First(&account, "account_id = ?", payload.AccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	member := model.BillGroupMember{
+		BillGroupID: group.BillGroupID,
+		AccountID:   payload.AccountID,
+		Status:      model.MemberInvited,
+	}
+	if err := b.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member invited",
+		"data":    member,
+	})
+}
+
+// Join accepts the invitation of the current account to the group.
+func (b *billGroupImplement) Join(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	now := time.Now()
+
+	result := b.db.Model(&model.BillGroupMember{}).
+		Where("bill_group_id = ? AND account_id = ? AND status = ?", c.Param("id"), accountID, model.MemberInvited).
+		Updates(map[string]any{"status": model.MemberJoined, "joined_at": now})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Join success",
+	})
+}
+
+// AddExpense records an expense paid by the current account. Equal splits
+// divide the amount over the given participants (all members by default),
+// percentage and exact splits take a share per participant.
+func (b *billGroupImplement) AddExpense(c *gin.Context) {
+	var payload struct {
+		PaidByAccountID *int64  `json:"paid_by_account_id"`
+		Description     string  `json:"description"`
+		Amount          int64   `json:"amount"`
+		SplitType       string  `json:"split_type"`
+		Participants    []int64 `json:"participants"`
+		Shares          []struct {
+			AccountID int64   `json:"account_id"`
+			Percent   float64 `json:"percent"`
+			Amount    int64   `json:"amount"`
+		} `json:"shares"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	group, ok := b.memberGroup(c)
+	if !ok {
+		return
+	}
+
+	members := joinedMembers(group)
+
+	// Nobody can book a debt in the name of another member
+	paidBy := c.GetInt64("account_id")
+	if payload.PaidByAccountID != nil && *payload.PaidByAccountID != paidBy {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expenses can only be paid by the current account"})
+		return
+	}
+
+	if payload.SplitType == "" {
+		payload.SplitType = model.SplitEqual
+	}
+
+	var shares []model.BillExpenseShare
+	var err error
+	switch payload.SplitType {
+	case model.SplitEqual:
+		participants := payload.Participants
+		if len(participants) == 0 {
+			participants = sortedKeys(members)
+		}
+		shares, err = splitEqual(payload.Amount, participants)
+	case model.SplitPercentage:
+		percents := map[int64]float64{}
+		for _, share := range payload.Shares {
+			percents[share.AccountID] += share.Percent
+		}
+		shares, err = splitPercentage(payload.Amount, percents)
+	case model.SplitExact:
+		amounts := map[int64]int64{}
+		for _, share := range payload.Shares {
+			amounts[share.AccountID] += share.Amount
+		}
+		shares, err = splitExact(payload.Amount, amounts)
+	default:
+		err = errors.New("split_type must be equal, percentage or exact")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, share := range shares {
+		if !members[share.AccountID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Account %d is not a member of the group", share.AccountID)})
+			return
+		}
+	}
+
+	expense := model.BillExpense{
+		BillGroupID:     group.BillGroupID,
+		PaidByAccountID: paidBy,
+		Description:     payload.Description,
+		Amount:          payload.Amount,
+		SplitType:       payload.SplitType,
+		CreatedAt:       time.Now(),
+		Shares:          shares,
+	}
+	if err := b.db.Create(&expense).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create expense"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    expense,
+	})
+}
+
+// Balance returns the net balance of every member and the settle-up plan.
+func (b *billGroupImplement) Balance(c *gin.Context) {
+	group, ok := b.memberGroup(c)
+	if !ok {
+		return
+	}
+
+	balances, err := groupBalances(b.db, group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balances"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"balances": balances,
+			"plan":     settlePlan(balances),
+		},
+	})
+}
+
+// Settle pays the given creditor the amount the current account approved,
+// which may not exceed what the settle-up plan says it owes that creditor.
+func (b *billGroupImplement) Settle(c *gin.Context) {
+	var payload struct {
+		ToAccountID int64 `json:"to_account_id" binding:"required"`
+		Amount      int64 `json:"amount" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	group, ok := b.memberGroup(c)
+	if !ok {
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	var settlement model.BillSettlement
+
+	err := b.db.Transaction(func(tx *gorm.DB) error {
+		// Serialize settlements of the same group
+		var locked model.BillGroup
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&locked, "bill_group_id = ?", group.BillGroupID).Error
+		if err != nil {
+			return err
+		}
+
+		balances, err := groupBalances(tx, group)
+		if err != nil {
+			return err
+		}
+
+		var owed int64
+		for _, step := range settlePlan(balances) {
+			if step.FromAccountID == accountID && step.ToAccountID == payload.ToAccountID {
+				owed += step.Amount
+			}
+		}
+		if owed == 0 {
+			return errNothingToSettle
+		}
+		if payload.Amount > owed {
+			return errSettleExceeded
+		}
+
+		transaction, err := transferFunds(tx, accountID, payload.ToAccountID, payload.Amount, nil)
+		if err != nil {
+			return err
+		}
+
+		settlement = model.BillSettlement{
+			BillGroupID:   group.BillGroupID,
+			FromAccountID: accountID,
+			ToAccountID:   payload.ToAccountID,
+			Amount:        payload.Amount,
+			TransactionID: transaction.TransactionID,
+			CreatedAt:     time.Now(),
+		}
+		return tx.Create(&settlement).Error
+	})
+
+	switch {
+	case errors.Is(err, errNothingToSettle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to settle"})
+		return
+	case errors.Is(err, errSettleExceeded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the debt to this member"})
+		return
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Settle success",
+		"data":    settlement,
+	})
+}
+
+// memberGroup loads the group in the id parameter with its members, writing
+// a not found response when the current account has not joined it.
+func (b *billGroupImplement) memberGroup(c *gin.Context) (model.BillGroup, bool) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var group model.BillGroup
+	err := b.db.Preload("Members").First(&group, "bill_group_id = ?", id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return group, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return group, false
+	}
+
+	if joinedMembers(group)[accountID] {
+		return group, true
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	return group, false
+}
+
+// groupBalances computes what each member paid minus what they owe, adjusted
+// by the settlements already made.
+func groupBalances(db *gorm.DB, group model.BillGroup) ([]memberBalance, error) {
+	net := map[int64]int64{}
+	for accountID := range joinedMembers(group) {
+		net[accountID] = 0
+	}
+
+	type accountAmount struct {
+		AccountID int64
+		Amount    int64
+	}
+
+	var paid []accountAmount
+	err := db.Model(&model.BillExpense{}).
+		Select("paid_by_account_id AS account_id, SUM(amount) AS amount").
+		Where("bill_group_id = ?", group.BillGroupID).
+		Group("paid_by_account_id").
+		Scan(&paid).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range paid {
+		net[row.AccountID] += row.Amount
+	}
+
+	var owed []accountAmount
+	err = db.Table("bill_expense_shares").
+		Select("bill_expense_shares.account_id, SUM(bill_expense_shares.amount) AS amount").
+		Joins("JOIN bill_expenses ON bill_expenses.bill_expense_id = bill_expense_shares.bill_expense_id").
+		Where("bill_expenses.bill_group_id = ?", group.BillGroupID).
+		Group("bill_expense_shares.account_id").
+		Scan(&owed).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range owed {
+		net[row.AccountID] -= row.Amount
+	}
+
+	var settlements []model.BillSettlement
+	if err := db.Where("bill_group_id = ?", group.BillGroupID).Find(&settlements).Error; err != nil {
+		return nil, err
+	}
+	for _, settlement := range settlements {
+		net[settlement.FromAccountID] += settlement.Amount
+		net[settlement.ToAccountID] -= settlement.Amount
+	}
+
+	balances := []memberBalance{}
+	for accountID, balance := range net {
+		balances = append(balances, memberBalance{AccountID: accountID, Balance: balance})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].AccountID < balances[j].AccountID
+	})
+
+	return balances, nil
+}
+
+// joinedMembers returns the accounts that accepted their invitation.
+func joinedMembers(group model.BillGroup) map[int64]bool {
+	joined := map[int64]bool{}
+	for _, member := range group.Members {
+		if member.Status == model.MemberJoined {
+			joined[member.AccountID] = true
+		}
+	}
+	return joined
+}
+
+// settlePlan greedily matches the largest debtor with the largest creditor,
+// which needs at most one transfer less than the number of members.
+func settlePlan(balances []memberBalance) []settleStep {
+	var debtors, creditors []memberBalance
+	for _, balance := range balances {
+		switch {
+		case balance.Balance < 0:
+			debtors = append(debtors, memberBalance{balance.AccountID, -balance.Balance})
+		case balance.Balance > 0:
+			creditors = append(creditors, balance)
+		}
+	}
+
+	largestFirst := func(list []memberBalance) {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Balance > list[j].Balance
+		})
+	}
+
+	plan := []settleStep{}
+	for len(debtors) > 0 && len(creditors) > 0 {
+		largestFirst(debtors)
+		largestFirst(creditors)
+
+		amount := debtors[0].Balance
+		if creditors[0].Balance < amount {
+			amount = creditors[0].Balance
+		}
+		plan = append(plan, settleStep{
+			FromAccountID: debtors[0].AccountID,
+			ToAccountID:   creditors[0].AccountID,
+			Amount:        amount,
+		})
+
+		debtors[0].Balance -= amount
+		creditors[0].Balance -= amount
+		if debtors[0].Balance == 0 {
+			debtors = debtors[1:]
+		}
+		if creditors[0].Balance == 0 {
+			creditors = creditors[1:]
+		}
+	}
+
+	return plan
+}
+
+// splitEqual divides amount over participants, giving the remainder one unit
+// at a time to the first participants.
+func splitEqual(amount int64, participants []int64) ([]model.BillExpenseShare, error) {
+	unique := []int64{}
+	seen := map[int64]bool{}
+	for _, id := range participants {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("at least one participant is required")
+	}
+
+	count := int64(len(unique))
+	shares := []model.BillExpenseShare{}
+	for i, id := range unique {
+		share := amount / count
+		if int64(i) < amount%count {
+			share++
+		}
+		shares = append(shares, model.BillExpenseShare{AccountID: id, Amount: share})
+	}
+	return shares, nil
+}
+
+// splitPercentage divides amount by percentages that must add up to 100.
+// Percentages are rounded to basis points and rounding leftovers go to the
+// participants with the largest share.
+func splitPercentage(amount int64, percents map[int64]float64) ([]model.BillExpenseShare, error) {
+	if len(percents) == 0 {
+		return nil, errors.New("shares are required for a percentage split")
+	}
+
+	ids := sortedKeys(percents)
+	var totalBasisPoints int64
+	basisPoints := map[int64]int64{}
+	for _, id := range ids {
+		if percents[id] <= 0 {
+			return nil, errors.New("percentages must be greater than 0")
+		}
+		basisPoints[id] = int64(math.Round(percents[id] * 100))
+		totalBasisPoints += basisPoints[id]
+	}
+	if totalBasisPoints != 10000 {
+		return nil, errors.New("percentages must add up to 100")
+	}
+
+	shares := []model.BillExpenseShare{}
+	var assigned int64
+	for _, id := range ids {
+		share := amount * basisPoints[id] / 10000
+		assigned += share
+		shares = append(shares, model.BillExpenseShare{AccountID: id, Amount: share})
+	}
+
+	sort.SliceStable(shares, func(i, j int) bool {
+		return basisPoints[shares[i].AccountID] > basisPoints[shares[j].AccountID]
+	})
+	for i := 0; assigned < amount; i = (i + 1) % len(shares) {
+		shares[i].Amount++
+		assigned++
+	}
+	return shares, nil
+}
+
+// splitExact uses the given amounts, which must add up to the expense amount.
+func splitExact(amount int64, amounts map[int64]int64) ([]model.BillExpenseShare, error) {
+	if len(amounts) == 0 {
+		return nil, errors.New("shares are required for an exact split")
+	}
+
+	shares := []model.BillExpenseShare{}
+	var total int64
+	for _, id := range sortedKeys(amounts) {
+		if amounts[id] < 0 {
+			return nil, errors.New("share amounts must not be negative")
+		}
+		total += amounts[id]
+		shares = append(shares, model.BillExpenseShare{AccountID: id, Amount: amounts[id]})
+	}
+	if total != amount {
+		return nil, errors.New("share amounts must add up to the expense amount")
+	}
+	return shares, nil
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
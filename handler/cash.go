@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"godb/model"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	withdrawalCodeDigits   = 12
+	withdrawalCodeDuration = 30 * time.Minute
+)
+
+var (
+	errNotAgent            = errors.New("account is not an agent")
+	errWithdrawalClosed    = errors.New("withdrawal is no longer pending")
+	errWithdrawalExpired   = errors.New("withdrawal code expired")
+	errOwnWithdrawal       = errors.New("agent cannot pay out its own withdrawal")
+	errWithdrawalCodeTaken = errors.New("withdrawal code already in use")
+)
+
+type CashInterface interface {
+	Withdraw(*gin.Context)
+	Withdrawals(*gin.Context)
+	Cancel(*gin.Context)
+	Redeem(*gin.Context)
+	Deposit(*gin.Context)
+	SetAgent(*gin.Context)
+
+	ExpireStale() (int, error)
+}
+
+type cashImplement struct {
+	db *gorm.DB
+}
+
+func NewCash(db *gorm.DB) CashInterface {
+	return &cashImplement{
+		db: db,
+	}
+}
+
+// Withdraw reserves amount of the current account and returns a one-time
+// code that any agent can pay out in cash within 30 minutes. The code is
+// only shown once.
+func (h *cashImplement) Withdraw(c *gin.Context) {
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+
+	var code string
+	var withdrawal model.CashWithdrawal
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := holdFunds(tx, currentAccountID, payload.Amount); err != nil {
+			return err
+		}
+
+		var err error
+		code, err = newWithdrawalCode()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		withdrawal = model.CashWithdrawal{
+			AccountID: currentAccountID,
+			Amount:    payload.Amount,
+			CodeHash:  hashWithdrawalCode(code),
+			Status:    model.CashWithdrawalPending,
+			ExpiresAt: now.Add(withdrawalCodeDuration),
+			CreatedAt: now,
+		}
+
+		// A collision is very unlikely, but must not hand out a code twice
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&withdrawal)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errWithdrawalCodeTaken
+		}
+		return result.Error
+	})
+
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create withdrawal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data": gin.H{
+			"withdrawal": withdrawal,
+			"code":       code,
+		},
+	})
+}
+
+func (h *cashImplement) Withdrawals(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	status := c.DefaultQuery("status", "")
+
+	var withdrawals []model.CashWithdrawal
+
+	query := h.db.Where("account_id = ?", accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at desc").Find(&withdrawals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve withdrawals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": withdrawals,
+	})
+}
+
+// Cancel releases the money of a pending withdrawal of the current account.
+func (h *cashImplement) Cancel(c *gin.Context) {
+	currentAccountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var withdrawal model.CashWithdrawal
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&withdrawal, "cash_withdrawal_id = ? AND account_id = ?", id, currentAccountID).Error
+		if err != nil {
+			return err
+		}
+		if withdrawal.Status != model.CashWithdrawalPending {
+			return errWithdrawalClosed
+		}
+
+		return closeWithdrawal(tx, &withdrawal, model.CashWithdrawalCancelled)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	case errors.Is(err, errWithdrawalClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Withdrawal is " + withdrawal.Status})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Withdrawal cancelled",
+		"data":    withdrawal,
+	})
+}
+
+// Redeem is called by an agent paying out a withdrawal in cash. The reserved
+// money moves from the customer to the float of the agent.
+func (h *cashImplement) Redeem(c *gin.Context) {
+	var payload struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	agentID := c.GetInt64("account_id")
+
+	var withdrawal model.CashWithdrawal
+	var transaction model.Transaction
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := requireAgent(tx, agentID); err != nil {
+			return err
+		}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&withdrawal, "code_hash = ?", hashWithdrawalCode(payload.Code)).Error
+		if err != nil {
+			return err
+		}
+		if withdrawal.Status != model.CashWithdrawalPending {
+			return errWithdrawalClosed
+		}
+		if withdrawal.AccountID == agentID {
+			return errOwnWithdrawal
+		}
+		if time.Now().After(withdrawal.ExpiresAt) {
+			return errWithdrawalExpired
+		}
+
+		if err := releaseFunds(tx, withdrawal.AccountID, withdrawal.Amount); err != nil {
+			return err
+		}
+
+		transaction = model.Transaction{
+			AccountID:     &withdrawal.AccountID,
+			FromAccountID: &withdrawal.AccountID,
+			ToAccountID:   &agentID,
+			Amount:        withdrawal.Amount,
+			Type:          model.TransactionTypeWithdrawal,
+		}
+		if err := postTransaction(tx, &transaction); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		withdrawal.Status = model.CashWithdrawalRedeemed
+		withdrawal.AgentAccountID = &agentID
+		withdrawal.TransactionID = &transaction.TransactionID
+		withdrawal.RedeemedAt = &now
+		return tx.Save(&withdrawal).Error
+	})
+
+	switch {
+	case errors.Is(err, errNotAgent):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only agents can pay out withdrawals"})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid withdrawal code"})
+		return
+	case errors.Is(err, errWithdrawalClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Withdrawal is " + withdrawal.Status})
+		return
+	case errors.Is(err, errWithdrawalExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Withdrawal code expired"})
+		return
+	case errors.Is(err, errOwnWithdrawal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pay out your own withdrawal"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem withdrawal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Withdrawal redeemed",
+		"data": gin.H{
+			"withdrawal":  withdrawal,
+			"transaction": transaction,
+		},
+	})
+}
+
+// Deposit is called by an agent taking cash from a customer. The amount
+// moves from the float of the agent to the customer.
+func (h *cashImplement) Deposit(c *gin.Context) {
+	var payload struct {
+		AccountID int64 `json:"account_id"`
+		Amount    int64 `json:"amount"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	agentID := c.GetInt64("account_id")
+	if payload.AccountID == agentID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot deposit into your own account"})
+		return
+	}
+
+	var transaction model.Transaction
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := requireAgent(tx, agentID); err != nil {
+			return err
+		}
+
+		transaction = model.Transaction{
+			AccountID:     &agentID,
+			FromAccountID: &agentID,
+			ToAccountID:   &payload.AccountID,
+			Amount:        payload.Amount,
+			Type:          model.TransactionTypeDeposit,
+		}
+		return postTransaction(tx, &transaction)
+	})
+
+	switch {
+	case errors.Is(err, errNotAgent):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only agents can take deposits"})
+		return
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient agent float"})
+		return
+	case errors.Is(err, errAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete deposit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Deposit successful",
+		"data":    transaction,
+	})
+}
+
+// SetAgent turns an account into an agent or back. Admin only.
+func (h *cashImplement) SetAgent(c *gin.Context) {
+	var payload struct {
+		IsAgent bool `json:"is_agent"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	result := h.db.Model(&model.Account{}).
+		Where("account_id = ?", id).
+		Update("is_agent", payload.IsAgent)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+	})
+}
+
+// ExpireStale releases every pending withdrawal whose code has expired and
+// returns how many were expired. It is run periodically from main.
+func (h *cashImplement) ExpireStale() (int, error) {
+	expired := 0
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var withdrawals []model.CashWithdrawal
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expires_at < ?", model.CashWithdrawalPending, time.Now()).
+			Limit(100).
+			Find(&withdrawals).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range withdrawals {
+			if err := closeWithdrawal(tx, &withdrawals[i], model.CashWithdrawalExpired); err != nil {
+				return err
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// closeWithdrawal releases the reserved money and marks the withdrawal with status.
+func closeWithdrawal(tx *gorm.DB, withdrawal *model.CashWithdrawal, status string) error {
+	if err := releaseFunds(tx, withdrawal.AccountID, withdrawal.Amount); err != nil {
+		return err
+	}
+
+	withdrawal.Status = status
+	return tx.Model(withdrawal).Update("status", status).Error
+}
+
+func requireAgent(tx *gorm.DB, accountID int64) error {
+	var account model.Account
+	if err := tx.Select("is_agent").First(&account, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNotAgent
+		}
+		return err
+	}
+	if !account.IsAgent {
+		return errNotAgent
+	}
+	return nil
+}
+
+func newWithdrawalCode() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(withdrawalCodeDigits), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", withdrawalCodeDigits, n), nil
+}
+
+func hashWithdrawalCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"godb/finformat"
+	"godb/model"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 500
+
+// exportCurrency is the currency of every account.
+const exportCurrency = "IDR"
+
+// statementFormats are the export formats finance tools import. They carry
+// balances, so they are written in one go instead of per column.
+var statementFormats = map[string]struct {
+	Extension   string
+	ContentType string
+	Write       func(io.Writer, finformat.Statement) error
+}{
+	"ofx":     {"ofx", "application/x-ofx", finformat.WriteOFX},
+	"qif":     {"qif", "application/qif", finformat.WriteQIF},
+	"camt053": {"xml", "application/xml", finformat.WriteCAMT053},
+}
+
+// exportColumn is a column an export can contain. Value returns either a
+// string or an int64 amount.
+type exportColumn struct {
+	Header string
+	Value  func(mutationEntry) any
+}
+
+var exportColumns = map[string]exportColumn{
+	"transaction_id": {"Transaction ID", func(e mutationEntry) any { return strconv.FormatInt(e.TransactionID, 10) }},
+	"date":           {"Date", func(e mutationEntry) any { return e.TransactionDate.Format("2006-01-02 15:04:05") }},
+	"type":           {"Type", func(e mutationEntry) any { return e.Type }},
+	"status":         {"Status", func(e mutationEntry) any { return e.Status }},
+	"direction":      {"Direction", func(e mutationEntry) any { return e.Direction }},
+	"counterparty_id": {"Counterparty ID", func(e mutationEntry) any {
+		if e.CounterpartyAccountID == nil {
+			return ""
+		}
+		return strconv.FormatInt(*e.CounterpartyAccountID, 10)
+	}},
+	"counterparty_name": {"Counterparty", func(e mutationEntry) any { return e.CounterpartyName }},
+	"category":          {"Category", func(e mutationEntry) any { return e.CategoryName }},
+	"amount":            {"Amount", func(e mutationEntry) any { return e.Amount }},
+	"signed_amount":     {"Signed Amount", func(e mutationEntry) any { return e.SignedAmount }},
+	"balance_after":     {"Balance", func(e mutationEntry) any { return e.BalanceAfter }},
+}
+
+var defaultExportColumns = []string{"date", "transaction_id", "type", "direction", "counterparty_name", "category", "signed_amount", "balance_after"}
+
+// Export downloads the mutations of the current account as CSV or XLSX
+// (?format=csv|xlsx), with the filters of MutationList. ?columns= picks and
+// orders the columns and ?locale=id|en sets the digit grouping of amounts.
+// Rows are streamed in batches, so long histories are never held in memory.
+// ?format=ofx|qif|camt053 writes a statement for finance tools instead.
+func (h *accountImplement) Export(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	format := c.DefaultQuery("format", "csv")
+	_, statementFormat := statementFormats[format]
+	if format != "csv" && format != "xlsx" && !statementFormat {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, xlsx, ofx, qif or camt053"})
+		return
+	}
+
+	locale := c.DefaultQuery("locale", "id")
+	if locale != "id" && locale != "en" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "locale must be id or en"})
+		return
+	}
+
+	names := defaultExportColumns
+	if raw := c.Query("columns"); raw != "" {
+		names = strings.Split(raw, ",")
+	}
+	columns := make([]exportColumn, 0, len(names))
+	for _, name := range names {
+		column, ok := exportColumns[strings.TrimSpace(name)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown column " + name})
+			return
+		}
+		columns = append(columns, column)
+	}
+
+	loc, err := accountLocation(h.db, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	query, ok := mutationQuery(c, h.db, accountID, loc)
+	if !ok {
+		return
+	}
+
+	if statementFormat {
+		h.exportStatement(c, query, accountID, loc, format)
+		return
+	}
+
+	filename := fmt.Sprintf("mutations-%d-%s.%s", accountID, time.Now().In(loc).Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "csv" {
+		err = exportCSV(c, h.db, query, accountID, loc, columns, locale)
+	} else {
+		err = exportXLSX(c, h.db, query, accountID, loc, columns)
+	}
+	if err != nil {
+		// The response has started, so the download is cut short instead
+		log.Printf("exporting mutations of account %d failed: %v\n", accountID, err)
+		c.Abort()
+	}
+}
+
+func exportCSV(c *gin.Context, db *gorm.DB, query *gorm.DB, accountID int64, loc *time.Location, columns []exportColumn, locale string) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.Header
+	}
+	if err := w.Write(record); err != nil {
+		return err
+	}
+
+	err := eachMutationBatch(db, query, accountID, loc, func(entries []mutationEntry) error {
+		for _, entry := range entries {
+			for i, column := range columns {
+				switch value := column.Value(entry).(type) {
+				case int64:
+					record[i] = formatAmount(value, locale)
+				case string:
+					record[i] = csvText(value)
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// csvText keeps a spreadsheet from running text, such as a description,
+// as a formula by prefixing the characters that start one with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func exportXLSX(c *gin.Context, db *gorm.DB, query *gorm.DB, accountID int64, loc *time.Location, columns []exportColumn) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	// Excel renders the digit grouping in the locale of the reader
+	amountStyle, err := f.NewStyle(&excelize.Style{NumFmt: 3})
+	if err != nil {
+		return err
+	}
+
+	sheet, err := f.NewStreamWriter("Sheet1")
+	if err != nil {
+		return err
+	}
+
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+	if err := sheet.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	row := 1
+	err = eachMutationBatch(db, query, accountID, loc, func(entries []mutationEntry) error {
+		for _, entry := range entries {
+			row++
+			cells := make([]any, len(columns))
+			for i, column := range columns {
+				value := column.Value(entry)
+				if amount, ok := value.(int64); ok {
+					value = excelize.Cell{StyleID: amountStyle, Value: amount}
+				}
+				cells[i] = value
+			}
+
+			cell, err := excelize.CoordinatesToCellName(1, row)
+			if err != nil {
+				return err
+			}
+			if err := sheet.SetRow(cell, cells); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sheet.Flush(); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	return f.Write(c.Writer)
+}
+
+// exportStatement writes the transactions of query, oldest first, in one of
+// statementFormats. The period is the requested date range, and the balances
+// are those of the account at its bounds whatever the other filters are.
+func (h *accountImplement) exportStatement(c *gin.Context, query *gorm.DB, accountID int64, loc *time.Location, format string) {
+	var account model.Account
+	if err := h.db.Select("account_id", "name").First(&account, "account_id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	now := time.Now().In(loc)
+	statement := finformat.Statement{
+		AccountID:   account.AccountID,
+		AccountName: account.Name,
+		Currency:    exportCurrency,
+		To:          now,
+		CreatedAt:   now,
+	}
+
+	// mutationQuery already rejected malformed bounds
+	if startDate := c.Query("start_date"); startDate != "" {
+		statement.From, _, _ = parseDateBound(startDate, loc)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		end, dateOnly, _ := parseDateBound(endDate, loc)
+		if dateOnly {
+			end = end.AddDate(0, 0, 1)
+		}
+		if end.Before(now) {
+			statement.To = end.In(loc)
+		}
+	}
+
+	var entries []mutationEntry
+	err := eachMutationBatch(h.db, query, accountID, loc, func(batch []mutationEntry) error {
+		entries = append(entries, batch...)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve mutations"})
+		return
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		statement.Entries = append(statement.Entries, finformat.Entry{
+			ID:       entry.TransactionID,
+			Date:     entry.TransactionDate,
+			Amount:   entry.SignedAmount,
+			Type:     entry.Type,
+			Name:     entry.CounterpartyName,
+			Category: entry.CategoryName,
+		})
+	}
+	if statement.From.IsZero() {
+		statement.From = statement.To
+		if len(statement.Entries) > 0 {
+			statement.From = statement.Entries[0].Date
+		}
+	}
+
+	if statement.OpeningBalance, err = balanceAt(h.db, accountID, statement.From); err == nil {
+		statement.ClosingBalance, err = balanceAt(h.db, accountID, statement.To)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve balance"})
+		return
+	}
+
+	spec := statementFormats[format]
+	filename := fmt.Sprintf("mutations-%d-%s.%s", accountID, now.Format("20060102"), spec.Extension)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", spec.ContentType)
+	c.Status(http.StatusOK)
+
+	if err := spec.Write(c.Writer, statement); err != nil {
+		log.Printf("exporting mutations of account %d failed: %v\n", accountID, err)
+		c.Abort()
+	}
+}
+
+// eachMutationBatch walks every transaction of query, newest first, and
+// passes them to fn as mutation entries, exportBatchSize at a time.
+func eachMutationBatch(db *gorm.DB, query *gorm.DB, accountID int64, loc *time.Location, fn func([]mutationEntry) error) error {
+	base := query.Session(&gorm.Session{})
+
+	var cursor *transactionCursor
+	for {
+		batch := base
+		if cursor != nil {
+			batch = batch.Where("(transaction_date, transaction_id) < (?, ?)", cursor.Date, cursor.ID)
+		}
+
+		var transactions []model.Transaction
+		err := batch.Order("transaction_date desc, transaction_id desc").Limit(exportBatchSize).Find(&transactions).Error
+		if err != nil {
+			return err
+		}
+		if len(transactions) == 0 {
+			return nil
+		}
+
+		entries, err := enrichMutations(db, accountID, transactions, loc)
+		if err != nil {
+			return err
+		}
+		if err := fn(entries); err != nil {
+			return err
+		}
+
+		last := transactions[len(transactions)-1]
+		cursor = &transactionCursor{Date: last.TransactionDate, ID: last.TransactionID}
+		if len(transactions) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// formatAmount groups the digits of amount in thousands, with dots for id
+// and commas for en.
+func formatAmount(amount int64, locale string) string {
+	separator := "."
+	if locale == "en" {
+		separator = ","
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	sign := ""
+	if amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String()
+}
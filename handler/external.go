@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"godb/rail"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExternalTransferInterface interface {
+	Create(*gin.Context)
+	Read(*gin.Context)
+	List(*gin.Context)
+
+	SubmitPending() (int, error)
+	Finalize(result rail.Result) error
+}
+
+type externalTransferImplement struct {
+	db                *gorm.DB
+	rail              rail.PaymentRail
+	clearingAccountID int64
+}
+
+// NewExternalTransfer sends transfers over paymentRail, parking the money in
+// clearingAccountID until the rail reports the outcome. A zero
+// clearingAccountID disables external transfers.
+func NewExternalTransfer(db *gorm.DB, paymentRail rail.PaymentRail, clearingAccountID int64) ExternalTransferInterface {
+	return &externalTransferImplement{
+		db:                db,
+		rail:              paymentRail,
+		clearingAccountID: clearingAccountID,
+	}
+}
+
+// Create debits the current account into the clearing account and queues
+// the transfer for the payment rail. Clients poll Read for the outcome.
+func (h *externalTransferImplement) Create(c *gin.Context) {
+	var payload struct {
+		BankCode      string `json:"bank_code"`
+		AccountNumber string `json:"account_number"`
+		AccountName   string `json:"account_name"`
+		Amount        int64  `json:"amount"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if h.clearingAccountID == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "External transfers are not available"})
+		return
+	}
+
+	transfer := model.ExternalTransfer{
+		AccountID:     c.GetInt64("account_id"),
+		BankCode:      strings.TrimSpace(payload.BankCode),
+		AccountNumber: strings.TrimSpace(payload.AccountNumber),
+		AccountName:   strings.TrimSpace(payload.AccountName),
+		Amount:        payload.Amount,
+		Status:        model.ExternalTransferPending,
+	}
+	if transfer.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+	if transfer.BankCode == "" || transfer.AccountNumber == "" || transfer.AccountName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank_code, account_number and account_name are required"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		debit := model.Transaction{
+			AccountID:     &transfer.AccountID,
+			FromAccountID: &transfer.AccountID,
+			ToAccountID:   &h.clearingAccountID,
+			Amount:        transfer.Amount,
+			Type:          model.TransactionTypeExternalTransfer,
+		}
+		if err := postTransaction(tx, &debit); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		transfer.TransactionID = debit.TransactionID
+		transfer.CreatedAt = now
+		transfer.UpdatedAt = now
+		return tx.Create(&transfer).Error
+	})
+
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create external transfer"})
+		return
+	}
+
+	// Submit right away; SubmitPending picks it up if this fails
+	go func(id int64) {
+		if _, err := h.submitOne(id); err != nil {
+			log.Printf("submitting external transfer %d failed: %v\n", id, err)
+		}
+	}(transfer.ExternalTransferID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    transfer,
+	})
+}
+
+func (h *externalTransferImplement) Read(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var transfer model.ExternalTransfer
+	err := h.db.First(&transfer, "external_transfer_id = ? AND account_id = ?", id, accountID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": transfer,
+	})
+}
+
+func (h *externalTransferImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	status := c.DefaultQuery("status", "")
+
+	var transfers []model.ExternalTransfer
+
+	query := h.db.Where("account_id = ?", accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at desc").Find(&transfers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve external transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": transfers,
+	})
+}
+
+// SubmitPending hands every pending transfer to the payment rail and returns
+// how many were submitted. It is run periodically from main.
+func (h *externalTransferImplement) SubmitPending() (int, error) {
+	var ids []int64
+	err := h.db.Model(&model.ExternalTransfer{}).
+		Where("status = ?", model.ExternalTransferPending).
+		Order("created_at").
+		Limit(100).
+		Pluck("external_transfer_id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	submitted := 0
+	for _, id := range ids {
+		ok, err := h.submitOne(id)
+		if err != nil {
+			return submitted, err
+		}
+		if ok {
+			submitted++
+		}
+	}
+
+	return submitted, nil
+}
+
+// submitOne submits a single pending transfer. A payout the rail refuses
+// outright fails the transfer; other errors leave it pending for a retry.
+func (h *externalTransferImplement) submitOne(id int64) (bool, error) {
+	submitted := false
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var transfer model.ExternalTransfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", model.ExternalTransferPending).
+			First(&transfer, "external_transfer_id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Already submitted by another worker
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		reference, err := h.rail.Submit(rail.Payout{
+			ID:            transfer.ExternalTransferID,
+			BankCode:      transfer.BankCode,
+			AccountNumber: transfer.AccountNumber,
+			AccountName:   transfer.AccountName,
+			Amount:        transfer.Amount,
+		}, h.Finalize)
+		if errors.Is(err, rail.ErrInvalidPayout) {
+			return h.settle(tx, &transfer, rail.Result{PayoutID: id, Reason: err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		submitted = true
+
+		// The row stays locked until commit, so the callback cannot finalize
+		// the transfer before it is marked as submitted. Should the commit
+		// fail, the retry submits the same payout ID again, which the rail
+		// answers with the first reference instead of paying twice
+		return tx.Model(&transfer).Updates(map[string]any{
+			"status":         model.ExternalTransferSubmitted,
+			"rail_reference": reference,
+			"updated_at":     time.Now(),
+		}).Error
+	})
+
+	return submitted, err
+}
+
+// Finalize applies the outcome reported by the payment rail: the money
+// leaves the clearing account on success and goes back to the sender on
+// failure. Results for transfers already finalized are ignored.
+func (h *externalTransferImplement) Finalize(result rail.Result) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		var transfer model.ExternalTransfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&transfer, "external_transfer_id = ?", result.PayoutID).Error
+		if err != nil {
+			return err
+		}
+
+		if transfer.Status == model.ExternalTransferCompleted || transfer.Status == model.ExternalTransferFailed {
+			return nil
+		}
+		return h.settle(tx, &transfer, result)
+	})
+}
+
+func (h *externalTransferImplement) settle(tx *gorm.DB, transfer *model.ExternalTransfer, result rail.Result) error {
+	settlement := model.Transaction{
+		AccountID:            &transfer.AccountID,
+		FromAccountID:        &h.clearingAccountID,
+		Amount:               transfer.Amount,
+		RelatedTransactionID: &transfer.TransactionID,
+	}
+	if result.Success {
+		settlement.Type = model.TransactionTypeExternalTransfer
+		transfer.Status = model.ExternalTransferCompleted
+	} else {
+		settlement.ToAccountID = &transfer.AccountID
+		settlement.Type = model.TransactionTypeReversal
+		transfer.Status = model.ExternalTransferFailed
+		transfer.FailureReason = result.Reason
+	}
+	if err := postTransaction(tx, &settlement); err != nil {
+		return err
+	}
+
+	if result.Reference != "" {
+		transfer.RailReference = result.Reference
+	}
+	transfer.SettlementTransactionID = &settlement.TransactionID
+	transfer.UpdatedAt = time.Now()
+	return tx.Save(transfer).Error
+}
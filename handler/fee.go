@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FeeInterface interface {
+	Upsert(*gin.Context)
+	List(*gin.Context)
+	Delete(*gin.Context)
+	Quote(*gin.Context)
+	SetTier(*gin.Context)
+}
+
+type feeImplement struct {
+	db *gorm.DB
+}
+
+func NewFee(db *gorm.DB) FeeInterface {
+	return &feeImplement{
+		db: db,
+	}
+}
+
+// feeQuote is the fee an operation costs. For transfers the fee is debited
+// on top of the amount, for top-ups it is taken from the credited amount.
+type feeQuote struct {
+	Operation     string `json:"operation"`
+	Amount        int64  `json:"amount"`
+	Fee           int64  `json:"fee"`
+	Waived        bool   `json:"waived"`
+	FreeRemaining int    `json:"free_remaining"`
+	FeeRuleID     *int64 `json:"fee_rule_id"`
+}
+
+// Upsert creates or replaces the fee rule of an operation and tier. Admin only.
+func (f *feeImplement) Upsert(c *gin.Context) {
+	rule := model.FeeRule{}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if rule.Operation != model.FeeOperationTransfer && rule.Operation != model.FeeOperationTopUp {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Operation must be transfer or topup"})
+		return
+	}
+	if rule.Tier == "" {
+		rule.Tier = model.TierBasic
+	}
+	if rule.FlatFee < 0 || rule.Percent < 0 || rule.MinFee < 0 || rule.FreePerMonth < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fee values must not be negative"})
+		return
+	}
+	if rule.MaxFee != nil && *rule.MaxFee < rule.MinFee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_fee must not be less than min_fee"})
+		return
+	}
+
+	var revenue model.Account
+	if err := f.db.First(&revenue, "account_id = ?", rule.RevenueAccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revenue account not found"})
+		return
+	}
+
+	rule.CreatedAt = time.Now()
+	result := f.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "operation"}, {Name: "tier"}},
+		DoUpdates: clause.AssignmentColumns([]string{"flat_fee", "percent", "min_fee", "max_fee", "free_per_month", "revenue_account_id"}),
+	}).Create(&rule)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save fee rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    rule,
+	})
+}
+
+func (f *feeImplement) List(c *gin.Context) {
+	var rules []model.FeeRule
+	if err := f.db.Order("operation, tier").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fee rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rules,
+	})
+}
+
+func (f *feeImplement) Delete(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := f.db.Where("fee_rule_id = ?", id).Delete(&model.FeeRule{}).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data": map[string]string{
+			"fee_rule_id": id,
+		},
+	})
+}
+
+// Quote previews the fee the current account would pay for an operation.
+func (f *feeImplement) Quote(c *gin.Context) {
+	operation := c.DefaultQuery("operation", model.FeeOperationTransfer)
+	amount, err := strconv.ParseInt(c.Query("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	quote, err := quoteFee(f.db, c.GetInt64("account_id"), operation, amount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute fee"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": quote,
+	})
+}
+
+// SetTier moves an account to the tier its fees are charged by. Admin only.
+func (f *feeImplement) SetTier(c *gin.Context) {
+	var payload struct {
+		Tier string `json:"tier"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	if payload.Tier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tier is required"})
+		return
+	}
+
+	id := c.Param("id")
+	result := f.db.Model(&model.Account{}).
+		Where("account_id = ?", id).
+		Update("tier", payload.Tier)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+	})
+}
+
+// feeRuleFor returns the rule for operation on the tier of an account, or nil
+// when the operation is free.
+func feeRuleFor(db *gorm.DB, accountID int64, operation string) (*model.FeeRule, error) {
+	var account model.Account
+	if err := db.Select("tier").First(&account, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errAccountNotFound
+		}
+		return nil, err
+	}
+
+	var rule model.FeeRule
+	err := db.First(&rule, "operation = ? AND tier = ?", operation, account.Tier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The revenue account would only pay its fees to itself
+	if rule.RevenueAccountID == accountID {
+		return nil, nil
+	}
+	return &rule, nil
+}
+
+// quoteFee computes the fee without using up a free operation.
+func quoteFee(db *gorm.DB, accountID int64, operation string, amount int64) (feeQuote, error) {
+	quote := feeQuote{Operation: operation, Amount: amount}
+
+	rule, err := feeRuleFor(db, accountID, operation)
+	if err != nil || rule == nil {
+		return quote, err
+	}
+
+	var usage model.FeeUsage
+	err = db.Where("account_id = ? AND operation = ? AND period = ?", accountID, operation, feePeriod(time.Now())).
+		Limit(1).Find(&usage).Error
+	if err != nil {
+		return quote, err
+	}
+
+	fillQuote(&quote, rule, usage.Count+1)
+	return quote, nil
+}
+
+// chargeFee uses up one operation of the month and, when the operation is
+// not free, posts the fee from the account to the revenue account linked to
+// relatedID. A quotedFee, agreed on in a transfer quote, is charged instead
+// of the current fee. It must be called inside a database transaction.
+func chargeFee(tx *gorm.DB, accountID int64, operation string, amount int64, relatedID int64, quotedFee *int64) (feeQuote, error) {
+	quote := feeQuote{Operation: operation, Amount: amount}
+
+	rule, err := feeRuleFor(tx, accountID, operation)
+	if err != nil || rule == nil {
+		return quote, err
+	}
+
+	// Counting and reading back in one statement keeps concurrent operations
+	// from sharing the same free slot
+	var ordinal int
+	err = tx.Raw(`INSERT INTO fee_usages (account_id, operation, period, count) VALUES (?, ?, ?, 1)
+		ON CONFLICT (account_id, operation, period) DO UPDATE SET count = fee_usages.count + 1
+		RETURNING count`, accountID, operation, feePeriod(time.Now())).Scan(&ordinal).Error
+	if err != nil {
+		return quote, err
+	}
+
+	fillQuote(&quote, rule, ordinal)
+	if quotedFee != nil {
+		quote.Fee = *quotedFee
+		quote.Waived = quote.Fee == 0
+	}
+	if quote.Fee == 0 {
+		return quote, nil
+	}
+
+	categoryID, err := systemCategoryID(tx, model.CategoryFee)
+	if err != nil {
+		return quote, err
+	}
+
+	fee := model.Transaction{
+		AccountID:             &accountID,
+		FromAccountID:         &accountID,
+		ToAccountID:           &rule.RevenueAccountID,
+		TransactionCategoryID: categoryID,
+		Amount:                quote.Fee,
+		RelatedTransactionID:  &relatedID,
+		Type:                  model.TransactionTypeFee,
+	}
+	return quote, postTransaction(tx, &fee)
+}
+
+// fillQuote sets the fee of the ordinal-th operation of the month.
+func fillQuote(quote *feeQuote, rule *model.FeeRule, ordinal int) {
+	quote.FeeRuleID = &rule.FeeRuleID
+
+	quote.FreeRemaining = rule.FreePerMonth - ordinal
+	if quote.FreeRemaining < 0 {
+		quote.FreeRemaining = 0
+	}
+	if ordinal <= rule.FreePerMonth {
+		quote.Waived = true
+		return
+	}
+
+	fee := rule.FlatFee + int64(math.Round(float64(quote.Amount)*rule.Percent/100))
+	if fee < rule.MinFee {
+		fee = rule.MinFee
+	}
+	if rule.MaxFee != nil && fee > *rule.MaxFee {
+		fee = *rule.MaxFee
+	}
+	quote.Fee = fee
+}
+
+func feePeriod(t time.Time) string {
+	return t.Format("2006-01")
+}
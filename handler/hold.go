@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultHoldDuration = 24 * time.Hour
+	maxHoldDuration     = 7 * 24 * time.Hour
+)
+
+var (
+	errHoldNotActive   = errors.New("hold is no longer authorized")
+	errCaptureTooLarge = errors.New("capture exceeds authorized amount")
+)
+
+type HoldInterface interface {
+	Authorize(*gin.Context)
+	Capture(*gin.Context)
+	Void(*gin.Context)
+	List(*gin.Context)
+
+	ExpireStale() (int, error)
+}
+
+type holdImplement struct {
+	db *gorm.DB
+}
+
+func NewHold(db *gorm.DB) HoldInterface {
+	return &holdImplement{
+		db: db,
+	}
+}
+
+func (h *holdImplement) Authorize(c *gin.Context) {
+	var payload struct {
+		ToAccountID           int64  `json:"to_account_id"`
+		Amount                int64  `json:"amount"`
+		TransactionCategoryID *int64 `json:"transaction_category_id"`
+		ExpiresInMinutes      int    `json:"expires_in_minutes"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	if payload.ToAccountID == currentAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot hold funds for your own account"})
+		return
+	}
+
+	duration := defaultHoldDuration
+	if payload.ExpiresInMinutes > 0 {
+		duration = time.Duration(payload.ExpiresInMinutes) * time.Minute
+	}
+	if duration > maxHoldDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hold cannot last longer than 7 days"})
+		return
+	}
+
+	var targetAccount model.Account
+	if err := h.db.First(&targetAccount, "account_id = ?", payload.ToAccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+		return
+	}
+
+	if err := checkCategory(h.db, payload.TransactionCategoryID); err != nil {
+		if errors.Is(err, errCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(duration)
+	hold := model.Transaction{
+		AccountID:             &currentAccountID,
+		FromAccountID:         &currentAccountID,
+		ToAccountID:           &payload.ToAccountID,
+		TransactionCategoryID: payload.TransactionCategoryID,
+		Amount:                payload.Amount,
+		HoldAmount:            payload.Amount,
+		TransactionDate:       now,
+		Status:                model.TransactionStatusAuthorized,
+		ExpiresAt:             &expiresAt,
+		Type:                  model.TransactionTypeTransfer,
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := holdFunds(tx, currentAccountID, payload.Amount); err != nil {
+			return err
+		}
+		hold.FundsHeld = true
+		return tx.Create(&hold).Error
+	})
+	if errors.Is(err, errInsufficientBalance) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize hold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hold authorized",
+		"data":    hold,
+	})
+}
+
+// Capture moves the held money to the receiver. Only the receiver of the hold
+// can capture it, and may capture less than was authorized; the rest is
+// released back to the payer.
+func (h *holdImplement) Capture(c *gin.Context) {
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+
+	// The body is optional, an empty one means the full amount
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must not be negative"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var hold model.Transaction
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHold(tx, id, &hold); err != nil {
+			return err
+		}
+
+		if hold.ToAccountID == nil || *hold.ToAccountID != currentAccountID {
+			return gorm.ErrRecordNotFound
+		}
+
+		amount := payload.Amount
+		if amount == 0 {
+			amount = hold.HoldAmount
+		}
+		if amount > hold.HoldAmount {
+			return errCaptureTooLarge
+		}
+
+		if err := releaseFunds(tx, *hold.FromAccountID, hold.HoldAmount); err != nil {
+			return err
+		}
+		if err := moveFunds(tx, hold.FromAccountID, hold.ToAccountID, amount); err != nil {
+			return err
+		}
+
+		hold.Amount = amount
+		hold.FundsHeld = false
+		hold.Status = model.TransactionStatusCaptured
+		hold.TransactionDate = time.Now()
+		if err := tx.Save(&hold).Error; err != nil {
+			return err
+		}
+
+		// The payer pays the transfer fee once the money actually moves
+		_, err := chargeFee(tx, *hold.FromAccountID, model.FeeOperationTransfer, amount, hold.TransactionID, nil)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+		return
+	case errors.Is(err, errHoldNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Hold is " + hold.Status})
+		return
+	case errors.Is(err, errCaptureTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the authorized amount"})
+		return
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to capture hold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hold captured",
+		"data":    hold,
+	})
+}
+
+// Void releases the held money without moving it. Both the payer and the
+// receiver of the hold can void it.
+func (h *holdImplement) Void(c *gin.Context) {
+	currentAccountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var hold model.Transaction
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockHold(tx, id, &hold); err != nil {
+			return err
+		}
+
+		isPayer := hold.FromAccountID != nil && *hold.FromAccountID == currentAccountID
+		isReceiver := hold.ToAccountID != nil && *hold.ToAccountID == currentAccountID
+		if !isPayer && !isReceiver {
+			return gorm.ErrRecordNotFound
+		}
+
+		return closeHold(tx, &hold, model.TransactionStatusVoided)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+		return
+	case errors.Is(err, errHoldNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Hold is " + hold.Status})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void hold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hold voided",
+		"data":    hold,
+	})
+}
+
+func (h *holdImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	status := c.DefaultQuery("status", "")
+
+	var holds []model.Transaction
+
+	query := h.db.Where("hold_amount > 0 AND (from_account_id = ? OR to_account_id = ?)", accountID, accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("transaction_date desc").Find(&holds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve holds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": holds,
+	})
+}
+
+// ExpireStale releases every authorized hold whose expiry has passed and
+// returns how many were expired. It is run periodically from main.
+func (h *holdImplement) ExpireStale() (int, error) {
+	expired := 0
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var holds []model.Transaction
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND funds_held AND expires_at < ?", model.TransactionStatusAuthorized, time.Now()).
+			Limit(100).
+			Find(&holds).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range holds {
+			if err := closeHold(tx, &holds[i], model.TransactionStatusExpired); err != nil {
+				return err
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// lockHold locks a hold created by Authorize. Rows that merely look like a
+// hold but never reserved anything through holdFunds are not found.
+func lockHold(tx *gorm.DB, id string, hold *model.Transaction) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("hold_amount > 0 AND funds_held").
+		First(hold, "transaction_id = ?", id).Error
+	if err != nil {
+		return err
+	}
+
+	if hold.Status != model.TransactionStatusAuthorized {
+		return errHoldNotActive
+	}
+	return nil
+}
+
+// closeHold releases the reserved money and marks the hold with status.
+func closeHold(tx *gorm.DB, hold *model.Transaction, status string) error {
+	if err := releaseFunds(tx, *hold.FromAccountID, hold.HoldAmount); err != nil {
+		return err
+	}
+
+	hold.Status = status
+	hold.FundsHeld = false
+	return tx.Model(hold).Select("status", "funds_held").Updates(hold).Error
+}
@@ -0,0 +1,446 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"godb/model"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxImportRows  = 10000
+	maxImportBytes = 10 << 20
+)
+
+var (
+	// errImportRolledBack undoes an import that was a dry run or had bad rows.
+	errImportRolledBack = errors.New("import rolled back")
+	errImportTooLarge   = fmt.Errorf("import cannot have more than %d rows", maxImportRows)
+)
+
+type ImportInterface interface {
+	Import(*gin.Context)
+}
+
+type importImplement struct {
+	db *gorm.DB
+}
+
+func NewImport(db *gorm.DB) ImportInterface {
+	return &importImplement{
+		db: db,
+	}
+}
+
+// importMapping names the CSV column of every field. Amount is signed unless
+// Direction is mapped, in which case its values tell credits from debits.
+type importMapping struct {
+	Date               string   `json:"date"`
+	DateFormat         string   `json:"date_format"`
+	Amount             string   `json:"amount"`
+	ThousandsSeparator string   `json:"thousands_separator"`
+	Direction          string   `json:"direction"`
+	CreditValues       []string `json:"credit_values"`
+	DebitValues        []string `json:"debit_values"`
+	Category           string   `json:"category"`
+	Reference          string   `json:"reference"`
+	Description        string   `json:"description"`
+}
+
+// importRow is one parsed line of the file.
+type importRow struct {
+	Line        int
+	Date        time.Time
+	Amount      int64
+	Category    string
+	Reference   string
+	Description string
+	Fingerprint string
+	CategoryID  *int64
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importReport struct {
+	DryRun     bool          `json:"dry_run"`
+	Rows       int           `json:"rows"`
+	Imported   int           `json:"imported"`
+	Duplicates []int         `json:"duplicates"`
+	Errors     []importError `json:"errors"`
+}
+
+// Import loads the history of an account from a multipart upload: the CSV in
+// "file", the target "account_id", the column "mapping" as JSON and
+// "dry_run". Every row is checked and posted in one database transaction,
+// which is rolled back on a dry run or when any row fails, so the report of
+// a dry run is exactly what a real run would do. Rows already imported are
+// skipped. Admin only.
+func (h *importImplement) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	if _, err := c.MultipartForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import cannot be larger than %d MB", maxImportBytes>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	accountID, err := strconv.ParseInt(c.PostForm("account_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+		return
+	}
+	dryRun := c.PostForm("dry_run") == "true"
+
+	var mapping importMapping
+	if err := json.Unmarshal([]byte(c.PostForm("mapping")), &mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping", "details": err.Error()})
+		return
+	}
+	if mapping.Date == "" || mapping.Amount == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mapping needs the date and amount columns"})
+		return
+	}
+	if mapping.Direction != "" && (len(mapping.CreditValues) == 0 || len(mapping.DebitValues) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mapping a direction needs credit_values and debit_values"})
+		return
+	}
+	if mapping.DateFormat == "" {
+		mapping.DateFormat = "2006-01-02"
+	}
+
+	loc, err := accountLocation(h.db, accountID)
+	if err != nil {
+		if errors.Is(err, errAccountNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	rows, rowErrors, err := parseImportCSV(f, mapping, loc)
+	if errors.Is(err, errImportTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Import cannot have more than %d rows", maxImportRows)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	report := importReport{DryRun: dryRun, Rows: len(rows) + len(rowErrors), Duplicates: []int{}, Errors: rowErrors}
+
+	rows, err = h.resolve(accountID, rows, &report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate import"})
+		return
+	}
+
+	// Postings run in date order so the balance evolves as it did historically
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Date.Before(rows[j].Date) })
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			// A savepoint per row keeps a duplicate from aborting the rest
+			err := tx.Transaction(func(inner *gorm.DB) error {
+				return postImportRow(inner, accountID, row)
+			})
+			switch {
+			case errors.Is(err, errInsufficientBalance):
+				report.Errors = append(report.Errors, importError{Line: row.Line, Error: "Balance would become negative"})
+				continue
+			case isUniqueViolation(err):
+				// Imported by a concurrent import after resolve looked
+				report.Duplicates = append(report.Duplicates, row.Line)
+				continue
+			case err != nil:
+				return err
+			}
+			report.Imported++
+		}
+
+		if dryRun || len(report.Errors) > 0 {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportRolledBack) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import transactions"})
+		return
+	}
+
+	sort.Slice(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	sort.Ints(report.Duplicates)
+
+	if len(report.Errors) > 0 {
+		report.Imported = 0
+		status := http.StatusBadRequest
+		if dryRun {
+			status = http.StatusOK
+		}
+		c.JSON(status, gin.H{"error": "Import has invalid rows", "data": report})
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "Dry run successful", "data": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import successful", "data": report})
+}
+
+// resolve looks up the categories of rows and drops those imported before,
+// recording the problems in report. It returns the rows left to post.
+func (h *importImplement) resolve(accountID int64, rows []importRow, report *importReport) ([]importRow, error) {
+	names := []string{}
+	fingerprints := []string{}
+	for _, row := range rows {
+		if row.Category != "" {
+			names = append(names, row.Category)
+		}
+		fingerprints = append(fingerprints, row.Fingerprint)
+	}
+
+	categories := map[string]int64{}
+	if len(names) > 0 {
+		var found []model.TransactionCategories
+		if err := h.db.Where("name IN ?", names).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, category := range found {
+			categories[category.Name] = category.TransactionCatID
+		}
+	}
+
+	imported := map[string]bool{}
+	if len(fingerprints) > 0 {
+		var existing []string
+		err := h.db.Model(&model.ImportedTransaction{}).
+			Where("account_id = ? AND fingerprint IN ?", accountID, fingerprints).
+			Pluck("fingerprint", &existing).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, fingerprint := range existing {
+			imported[fingerprint] = true
+		}
+	}
+
+	left := []importRow{}
+	for _, row := range rows {
+		if imported[row.Fingerprint] {
+			report.Duplicates = append(report.Duplicates, row.Line)
+			continue
+		}
+		if row.Category != "" {
+			id, ok := categories[row.Category]
+			if !ok {
+				report.Errors = append(report.Errors, importError{Line: row.Line, Error: "Transaction category not found"})
+				continue
+			}
+			row.CategoryID = &id
+		}
+		left = append(left, row)
+	}
+
+	return left, nil
+}
+
+// postImportRow books one row against the account alone; the old system's
+// counterparties have no accounts here.
+func postImportRow(tx *gorm.DB, accountID int64, row importRow) error {
+	transaction := model.Transaction{
+		AccountID:             &accountID,
+		TransactionCategoryID: row.CategoryID,
+		Amount:                row.Amount,
+		TransactionDate:       row.Date,
+		Type:                  model.TransactionTypeImport,
+		Description:           row.Description,
+	}
+	if row.Amount < 0 {
+		transaction.Amount = -row.Amount
+		transaction.FromAccountID = &accountID
+	} else {
+		transaction.ToAccountID = &accountID
+	}
+
+	if err := postTransaction(tx, &transaction); err != nil {
+		return err
+	}
+
+	return tx.Create(&model.ImportedTransaction{
+		AccountID:     accountID,
+		Fingerprint:   row.Fingerprint,
+		TransactionID: transaction.TransactionID,
+		ImportedAt:    time.Now(),
+	}).Error
+}
+
+// parseImportCSV reads the rows of r with mapping. It only fails when the
+// file itself is unusable or has more than maxImportRows rows, which it stops
+// reading at; bad lines are returned as row errors.
+func parseImportCSV(r io.Reader, mapping importMapping, loc *time.Location) ([]importRow, []importError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[name]
+		if !ok {
+			return -1, fmt.Errorf("missing %s column", name)
+		}
+		return i, nil
+	}
+
+	indexes := map[string]int{}
+	for field, name := range map[string]string{
+		"date":        mapping.Date,
+		"amount":      mapping.Amount,
+		"direction":   mapping.Direction,
+		"category":    mapping.Category,
+		"reference":   mapping.Reference,
+		"description": mapping.Description,
+	} {
+		if indexes[field], err = column(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rows := []importRow{}
+	rowErrors := []importError{}
+	// Identical lines without a reference are told apart by their occurrence
+	seen := map[string]int{}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if line-1 > maxImportRows {
+			return nil, nil, errImportTooLarge
+		}
+
+		value := func(field string) string {
+			i := indexes[field]
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row, msg := parseImportRow(mapping, loc, value)
+		if msg != "" {
+			rowErrors = append(rowErrors, importError{Line: line, Error: msg})
+			continue
+		}
+		row.Line = line
+
+		key := strings.Join([]string{row.Date.UTC().Format(time.RFC3339), strconv.FormatInt(row.Amount, 10), row.Category, row.Reference}, "|")
+		seen[key]++
+		sum := sha256.Sum256([]byte(key + "|" + strconv.Itoa(seen[key])))
+		row.Fingerprint = hex.EncodeToString(sum[:])
+
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+// parseImportRow returns the row, or why it is invalid.
+func parseImportRow(mapping importMapping, loc *time.Location, value func(string) string) (importRow, string) {
+	var row importRow
+
+	date, err := time.ParseInLocation(mapping.DateFormat, value("date"), loc)
+	if err != nil {
+		return row, "Invalid date"
+	}
+	row.Date = date
+
+	raw := value("amount")
+	if mapping.ThousandsSeparator != "" {
+		raw = strings.ReplaceAll(raw, mapping.ThousandsSeparator, "")
+	}
+	amount, err := strconv.ParseInt(raw, 10, 64)
+	// The smallest int64 has no positive counterpart to post
+	if err != nil || amount == math.MinInt64 {
+		return row, "Invalid amount"
+	}
+	if amount == 0 {
+		return row, "Amount must not be 0"
+	}
+
+	if mapping.Direction != "" {
+		if amount < 0 {
+			return row, "Amount must be positive when a direction is mapped"
+		}
+		direction := value("direction")
+		switch {
+		case containsFold(mapping.CreditValues, direction):
+		case containsFold(mapping.DebitValues, direction):
+			amount = -amount
+		default:
+			return row, "Unknown direction " + direction
+		}
+	}
+	row.Amount = amount
+
+	row.Category = value("category")
+	row.Reference = value("reference")
+	row.Description = value("description")
+	return row, ""
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"godb/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errAccountNotFound     = errors.New("account not found")
+	errTargetNotFound      = errors.New("target account not found")
+	errInsufficientBalance = errors.New("insufficient balance")
+	errInvalidTransaction  = errors.New("invalid transaction")
+	errNotHeld             = errors.New("amount is not held")
+)
+
+// movedStatuses are the transaction statuses that actually moved money.
+var movedStatuses = []string{model.TransactionStatusCompleted, model.TransactionStatusCaptured}
+
+// availableBalance is the part of the balance that is not reserved by holds.
+const availableBalance = "COALESCE(balance, 0) - held_balance"
+
+// debitAccount takes amount from the available balance of an account.
+func debitAccount(tx *gorm.DB, accountID, amount int64) error {
+	result := tx.Model(&model.Account{}).
+		Where("account_id = ? AND "+availableBalance+" >= ?", accountID, amount).
+		Update("balance", gorm.Expr("COALESCE(balance, 0) - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return missingOrShort(tx, accountID)
+	}
+	return nil
+}
+
+// creditAccount adds amount to the balance of an account.
+func creditAccount(tx *gorm.DB, accountID, amount int64) error {
+	result := tx.Model(&model.Account{}).
+		Where("account_id = ?", accountID).
+		Update("balance", gorm.Expr("COALESCE(balance, 0) + ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errAccountNotFound
+	}
+	return nil
+}
+
+// holdFunds reserves amount so it can no longer be spent, without moving it.
+func holdFunds(tx *gorm.DB, accountID, amount int64) error {
+	result := tx.Model(&model.Account{}).
+		Where("account_id = ? AND "+availableBalance+" >= ?", accountID, amount).
+		Update("held_balance", gorm.Expr("held_balance + ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return missingOrShort(tx, accountID)
+	}
+	return nil
+}
+
+// releaseFunds gives back an amount previously reserved with holdFunds. It
+// never releases more than is held, so the held balance cannot go negative.
+func releaseFunds(tx *gorm.DB, accountID, amount int64) error {
+	result := tx.Model(&model.Account{}).
+		Where("account_id = ? AND held_balance >= ?", accountID, amount).
+		Update("held_balance", gorm.Expr("held_balance - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errNotHeld
+	}
+	return nil
+}
+
+func missingOrShort(tx *gorm.DB, accountID int64) error {
+	var count int64
+	if err := tx.Model(&model.Account{}).Where("account_id = ?", accountID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errAccountNotFound
+	}
+	return errInsufficientBalance
+}
+
+// moveFunds debits the sender and credits the receiver. Either side may be
+// nil for money entering or leaving the system.
+func moveFunds(tx *gorm.DB, fromAccountID, toAccountID *int64, amount int64) error {
+	if fromAccountID != nil {
+		if err := debitAccount(tx, *fromAccountID, amount); err != nil {
+			return err
+		}
+	}
+	if toAccountID != nil {
+		if err := creditAccount(tx, *toAccountID, amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postTransaction moves the money described by t and records it in the
+// transaction table. It must be called inside a database transaction.
+func postTransaction(tx *gorm.DB, t *model.Transaction) error {
+	if msg := validateTransaction(*t); msg != "" {
+		return fmt.Errorf("%w: %s", errInvalidTransaction, msg)
+	}
+	if err := moveFunds(tx, t.FromAccountID, t.ToAccountID, t.Amount); err != nil {
+		return err
+	}
+
+	if t.Status == "" {
+		t.Status = model.TransactionStatusCompleted
+	}
+	if t.TransactionDate.IsZero() {
+		t.TransactionDate = time.Now()
+	}
+	return tx.Create(t).Error
+}
+
+// transactionShape tells which fields a type of transaction needs. OneOf
+// means exactly one of the two accounts.
+type transactionShape struct {
+	From    bool
+	To      bool
+	NoFrom  bool
+	OneOf   bool
+	Related bool
+	Pocket  bool
+}
+
+var transactionShapes = map[string]transactionShape{
+	model.TransactionTypeTopUp:            {To: true, NoFrom: true},
+	model.TransactionTypeTransfer:         {From: true, To: true},
+	model.TransactionTypeFee:              {From: true, To: true},
+	model.TransactionTypeInterest:         {To: true, NoFrom: true},
+	model.TransactionTypeReversal:         {From: true, To: true, Related: true},
+	model.TransactionTypeAdjustment:       {OneOf: true},
+	model.TransactionTypeWithdrawal:       {From: true},
+	model.TransactionTypeDeposit:          {To: true},
+	model.TransactionTypeExternalTransfer: {From: true},
+	model.TransactionTypeImport:           {OneOf: true},
+	model.TransactionTypePocket:           {OneOf: true, Pocket: true},
+}
+
+var transactionStatuses = map[string]bool{
+	model.TransactionStatusCompleted:  true,
+	model.TransactionStatusAuthorized: true,
+	model.TransactionStatusCaptured:   true,
+	model.TransactionStatusVoided:     true,
+	model.TransactionStatusExpired:    true,
+}
+
+// validateTransaction returns why t is not a valid transaction of its type,
+// or an empty string.
+func validateTransaction(t model.Transaction) string {
+	if t.Type == "" {
+		return "Type is required"
+	}
+	shape, ok := transactionShapes[t.Type]
+	if !ok {
+		return "Unknown transaction type " + t.Type
+	}
+	if t.Status != "" && !transactionStatuses[t.Status] {
+		return "Unknown transaction status " + t.Status
+	}
+	if t.Amount <= 0 {
+		return "Amount must be greater than 0"
+	}
+
+	switch {
+	case shape.From && t.FromAccountID == nil:
+		return "Transactions of type " + t.Type + " need from_account_id"
+	case shape.To && t.ToAccountID == nil:
+		return "Transactions of type " + t.Type + " need to_account_id"
+	case shape.OneOf && (t.FromAccountID == nil) == (t.ToAccountID == nil):
+		return "Transactions of type " + t.Type + " need exactly one of from_account_id and to_account_id"
+	case shape.NoFrom && t.FromAccountID != nil:
+		return "Transactions of type " + t.Type + " cannot have from_account_id"
+	case shape.Related && t.RelatedTransactionID == nil:
+		return "Transactions of type " + t.Type + " need related_transaction_id"
+	case shape.Pocket && t.PocketID == nil:
+		return "Transactions of type " + t.Type + " need pocket_id"
+	case t.FromAccountID != nil && t.ToAccountID != nil && *t.FromAccountID == *t.ToAccountID:
+		return "from_account_id and to_account_id must differ"
+	}
+	return ""
+}
+
+// transferFunds is the account-to-account transfer shared by every feature
+// that sends money on behalf of a user, transfer fee included. It must be
+// called inside a database transaction.
+func transferFunds(tx *gorm.DB, fromAccountID, toAccountID, amount int64, categoryID *int64) (model.Transaction, error) {
+	transaction, _, err := transferFundsQuoted(tx, fromAccountID, toAccountID, amount, categoryID, nil)
+	return transaction, err
+}
+
+// transferFundsQuoted is transferFunds charging quotedFee, agreed on in a
+// transfer quote, instead of the current fee when it is set.
+func transferFundsQuoted(tx *gorm.DB, fromAccountID, toAccountID, amount int64, categoryID *int64, quotedFee *int64) (model.Transaction, feeQuote, error) {
+	var target model.Account
+	if err := tx.Select("account_id").First(&target, "account_id = ?", toAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Transaction{}, feeQuote{}, errTargetNotFound
+		}
+		return model.Transaction{}, feeQuote{}, err
+	}
+	if err := checkCategory(tx, categoryID); err != nil {
+		return model.Transaction{}, feeQuote{}, err
+	}
+
+	transaction := model.Transaction{
+		AccountID:             &fromAccountID,
+		FromAccountID:         &fromAccountID,
+		ToAccountID:           &toAccountID,
+		TransactionCategoryID: categoryID,
+		Amount:                amount,
+		Type:                  model.TransactionTypeTransfer,
+	}
+	if err := postTransaction(tx, &transaction); err != nil {
+		return model.Transaction{}, feeQuote{}, err
+	}
+
+	quote, err := chargeFee(tx, fromAccountID, model.FeeOperationTransfer, amount, transaction.TransactionID, quotedFee)
+	if err != nil {
+		return model.Transaction{}, feeQuote{}, err
+	}
+
+	// The fee comes first: a sweep is skipped when the balance runs short,
+	// while a quoted transfer must not fail on money moved to a pocket
+	if err := applyAutoSave(tx, fromAccountID, amount); err != nil {
+		return model.Transaction{}, feeQuote{}, err
+	}
+
+	return transaction, quote, nil
+}
+
+// balanceAt returns the balance an account had at t, by undoing every
+// posting made since.
+func balanceAt(db *gorm.DB, accountID int64, t time.Time) (int64, error) {
+	var account model.Account
+	if err := db.Select("balance").First(&account, "account_id = ?", accountID).Error; err != nil {
+		return 0, err
+	}
+
+	var since struct {
+		Net int64
+	}
+	err := db.Model(&model.Transaction{}).
+		Select("COALESCE(SUM(CASE WHEN to_account_id = ? THEN amount ELSE 0 END) - SUM(CASE WHEN from_account_id = ? THEN amount ELSE 0 END), 0) AS net", accountID, accountID).
+		Where("(from_account_id = ? OR to_account_id = ?) AND status IN ? AND transaction_date >= ?", accountID, accountID, movedStatuses, t).
+		Scan(&since).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return account.Balance - since.Net, nil
+}
+
+// checkCategory returns errCategoryNotFound unless categoryID is nil or an
+// existing transaction category.
+func checkCategory(db *gorm.DB, categoryID *int64) error {
+	if categoryID == nil {
+		return nil
+	}
+	var category model.TransactionCategories
+	if err := db.First(&category, "transaction_category_id = ?", *categoryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errCategoryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// systemCategoryID returns the id of the transaction category used for
+// postings made by the system itself, creating it when missing.
+func systemCategoryID(tx *gorm.DB, name string) (*int64, error) {
+	category := model.TransactionCategories{}
+	if err := tx.Where(model.TransactionCategories{Name: name}).FirstOrCreate(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category.TransactionCatID, nil
+}
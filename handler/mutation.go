@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"godb/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Mutation directions relative to the account that lists them
+const (
+	directionIn  = "in"
+	directionOut = "out"
+)
+
+// defaultTimezone is used for accounts that never configured one.
+const defaultTimezone = "Asia/Jakarta"
+
+// mutationEntry is a transaction as seen from one account.
+type mutationEntry struct {
+	model.Transaction
+	Direction             string `json:"direction"`
+	SignedAmount          int64  `json:"signed_amount"`
+	CounterpartyAccountID *int64 `json:"counterparty_account_id"`
+	CounterpartyName      string `json:"counterparty_name"`
+	CategoryName          string `json:"category_name"`
+	BalanceAfter          int64  `json:"balance_after"`
+}
+
+// mutationQuery selects the moved transactions of accountID matching the
+// filters in the query string: start_date and end_date, direction (in or
+// out), category_id, min_amount and max_amount, and counterparty_id. When it
+// returns false it already wrote the error response.
+func mutationQuery(c *gin.Context, db *gorm.DB, accountID int64, loc *time.Location) (*gorm.DB, bool) {
+	query := db.Where("status IN ?", movedStatuses)
+
+	switch c.Query("direction") {
+	case "":
+		query = query.Where("from_account_id = ? OR to_account_id = ?", accountID, accountID)
+	case directionIn:
+		query = query.Where("to_account_id = ?", accountID)
+	case directionOut:
+		query = query.Where("from_account_id = ?", accountID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be in or out"})
+		return nil, false
+	}
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		startTime, _, err := parseDateBound(startDate, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return nil, false
+		}
+		query = query.Where("transaction_date >= ?", startTime)
+	}
+
+	if endDate := c.Query("end_date"); endDate != "" {
+		endTime, dateOnly, err := parseDateBound(endDate, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+			return nil, false
+		}
+		// A date-only end includes that whole day
+		if dateOnly {
+			query = query.Where("transaction_date < ?", endTime.AddDate(0, 0, 1))
+		} else {
+			query = query.Where("transaction_date <= ?", endTime)
+		}
+	}
+
+	if category := c.Query("category_id"); category != "" {
+		categoryID, err := strconv.ParseInt(category, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+			return nil, false
+		}
+		query = query.Where("transaction_category_id = ?", categoryID)
+	}
+
+	for param, op := range map[string]string{"min_amount": ">=", "max_amount": "<="} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		amount, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			return nil, false
+		}
+		query = query.Where("amount "+op+" ?", amount)
+	}
+
+	if counterparty := c.Query("counterparty_id"); counterparty != "" {
+		counterpartyID, err := strconv.ParseInt(counterparty, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid counterparty_id"})
+			return nil, false
+		}
+		query = query.Where("(from_account_id = ? AND to_account_id = ?) OR (from_account_id = ? AND to_account_id = ?)",
+			accountID, counterpartyID, counterpartyID, accountID)
+	}
+
+	return query, true
+}
+
+// parseDateBound accepts an RFC 3339 datetime or a date, which is taken as
+// midnight in loc. dateOnly tells which of the two it was.
+func parseDateBound(value string, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err = time.ParseInLocation("2006-01-02", value, loc)
+	return t, true, err
+}
+
+// accountLocation returns the configured timezone of an account.
+func accountLocation(db *gorm.DB, accountID int64) (*time.Location, error) {
+	var account model.Account
+	if err := db.Select("timezone").First(&account, "account_id = ?", accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errAccountNotFound
+		}
+		return nil, err
+	}
+
+	name := account.Timezone
+	if name == "" {
+		name = defaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.LoadLocation(defaultTimezone)
+	}
+	return loc, nil
+}
+
+// enrichMutations turns moved transactions of accountID into mutation
+// entries, with timestamps in loc. The balance after each entry is the
+// current balance minus everything the account moved later, read in one
+// snapshot so concurrent postings cannot skew it.
+func enrichMutations(db *gorm.DB, accountID int64, transactions []model.Transaction, loc *time.Location) ([]mutationEntry, error) {
+	entries := make([]mutationEntry, len(transactions))
+	if len(transactions) == 0 {
+		return entries, nil
+	}
+
+	ids := make([]int64, len(transactions))
+	oldest := transactions[0].TransactionDate
+	counterpartyIDs := []int64{}
+	categoryIDs := []int64{}
+	for i, t := range transactions {
+		entry := mutationEntry{Transaction: t}
+		if t.ToAccountID != nil && *t.ToAccountID == accountID {
+			entry.SignedAmount += t.Amount
+			entry.CounterpartyAccountID = t.FromAccountID
+		}
+		if t.FromAccountID != nil && *t.FromAccountID == accountID {
+			entry.SignedAmount -= t.Amount
+			entry.CounterpartyAccountID = t.ToAccountID
+		}
+		entry.Direction = directionIn
+		if entry.SignedAmount < 0 {
+			entry.Direction = directionOut
+		}
+		if entry.CounterpartyAccountID != nil {
+			counterpartyIDs = append(counterpartyIDs, *entry.CounterpartyAccountID)
+		}
+		if t.TransactionCategoryID != nil {
+			categoryIDs = append(categoryIDs, *t.TransactionCategoryID)
+		}
+
+		entries[i] = entry
+		ids[i] = t.TransactionID
+		if t.TransactionDate.Before(oldest) {
+			oldest = t.TransactionDate
+		}
+	}
+
+	names := map[int64]string{}
+	categories := map[int64]string{}
+	later := map[int64]int64{}
+	var balance int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var accounts []model.Account
+		if err := tx.Select("account_id", "name", "balance").Where("account_id IN ?", append(counterpartyIDs, accountID)).Find(&accounts).Error; err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			names[account.AccountID] = account.Name
+			if account.AccountID == accountID {
+				balance = account.Balance
+			}
+		}
+
+		var rows []model.TransactionCategories
+		if len(categoryIDs) > 0 {
+			if err := tx.Where("transaction_category_id IN ?", categoryIDs).Find(&rows).Error; err != nil {
+				return err
+			}
+		}
+		for _, category := range rows {
+			categories[category.TransactionCatID] = category.Name
+		}
+
+		// Postings older than the page cannot come after any of its entries
+		var sums []struct {
+			TransactionID int64
+			Later         int64
+		}
+		err := tx.Raw(`SELECT transaction_id, later FROM (
+				SELECT transaction_id, COALESCE(SUM(
+					CASE WHEN to_account_id = @account THEN amount ELSE 0 END -
+					CASE WHEN from_account_id = @account THEN amount ELSE 0 END
+				) OVER (ORDER BY transaction_date DESC, transaction_id DESC ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING), 0) AS later
+				FROM "transaction"
+				WHERE (from_account_id = @account OR to_account_id = @account) AND status IN @statuses AND transaction_date >= @oldest
+			) postings WHERE transaction_id IN @ids`,
+			sql.Named("account", accountID), sql.Named("statuses", movedStatuses),
+			sql.Named("oldest", oldest), sql.Named("ids", ids)).
+			Scan(&sums).Error
+		if err != nil {
+			return err
+		}
+		for _, sum := range sums {
+			later[sum.TransactionID] = sum.Later
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.CounterpartyAccountID != nil {
+			entry.CounterpartyName = names[*entry.CounterpartyAccountID]
+		}
+		if entry.TransactionCategoryID != nil {
+			entry.CategoryName = categories[*entry.TransactionCategoryID]
+		}
+		entry.BalanceAfter = balance - later[entry.TransactionID]
+
+		entry.TransactionDate = entry.TransactionDate.In(loc)
+		if entry.ExpiresAt != nil {
+			expiresAt := entry.ExpiresAt.In(loc)
+			entry.ExpiresAt = &expiresAt
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"godb/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// transactionCursor points just past the last transaction of a page. Pages
+// are ordered by transaction_date and transaction_id, newest first, so rows
+// sharing a date are neither skipped nor repeated.
+type transactionCursor struct {
+	Date time.Time `json:"d"`
+	ID   int64     `json:"i"`
+}
+
+// listEnvelope is the response of every paginated list. NextCursor is empty
+// on the last page.
+type listEnvelope struct {
+	Data       any    `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	Limit      int    `json:"limit"`
+}
+
+func encodeCursor(t model.Transaction) string {
+	raw, _ := json.Marshal(transactionCursor{Date: t.TransactionDate, ID: t.TransactionID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (transactionCursor, error) {
+	var cursor transactionCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == 0 {
+		return cursor, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// pageSize reads the limit query parameter, capped at maxPageSize.
+func pageSize(c *gin.Context) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
+
+// transactionPage loads the page of query after the cursor query parameter,
+// along with the cursor of the next page. When it returns false it already
+// wrote the error response.
+func transactionPage(c *gin.Context, query *gorm.DB) ([]model.Transaction, string, int, bool) {
+	limit, err := pageSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, "", 0, false
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return nil, "", 0, false
+		}
+		query = query.Where("(transaction_date, transaction_id) < (?, ?)", cursor.Date, cursor.ID)
+	}
+
+	// One extra row tells whether there is a next page
+	transactions := []model.Transaction{}
+	err = query.Order("transaction_date desc, transaction_id desc").Limit(limit + 1).Find(&transactions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transactions"})
+		return nil, "", 0, false
+	}
+
+	next := ""
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		next = encodeCursor(transactions[limit-1])
+	}
+
+	return transactions, next, limit, true
+}
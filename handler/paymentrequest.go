@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPaymentRequestDuration = 7 * 24 * time.Hour
+	maxPaymentRequestDuration     = 30 * 24 * time.Hour
+)
+
+var errPaymentRequestClosed = errors.New("payment request is no longer pending")
+
+type PaymentRequestInterface interface {
+	Create(*gin.Context)
+	Incoming(*gin.Context)
+	Outgoing(*gin.Context)
+	Accept(*gin.Context)
+	Decline(*gin.Context)
+	Cancel(*gin.Context)
+
+	ExpireStale() (int64, error)
+}
+
+type paymentRequestImplement struct {
+	db *gorm.DB
+}
+
+func NewPaymentRequest(db *gorm.DB) PaymentRequestInterface {
+	return &paymentRequestImplement{
+		db: db,
+	}
+}
+
+func (p *paymentRequestImplement) Create(c *gin.Context) {
+	var payload struct {
+		PayerAccountID int64  `json:"payer_account_id"`
+		Amount         int64  `json:"amount"`
+		Note           string `json:"note"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	if payload.PayerAccountID == currentAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot request money from your own account"})
+		return
+	}
+
+	duration := defaultPaymentRequestDuration
+	if payload.ExpiresInHours > 0 {
+		duration = time.Duration(payload.ExpiresInHours) * time.Hour
+	}
+	if duration > maxPaymentRequestDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment request cannot last longer than 30 days"})
+		return
+	}
+
+	var payer model.Account
+	if err := p.db.First(&payer, "account_id = ?", payload.PayerAccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payer account not found"})
+		return
+	}
+
+	now := time.Now()
+	request := model.PaymentRequest{
+		RequesterAccountID: currentAccountID,
+		PayerAccountID:     payload.PayerAccountID,
+		Amount:             payload.Amount,
+		Note:               payload.Note,
+		Status:             model.PaymentRequestPending,
+		ExpiresAt:          now.Add(duration),
+		CreatedAt:          now,
+	}
+
+	if err := p.db.Create(&request).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    request,
+	})
+}
+
+// Incoming lists the requests the current account has been asked to pay.
+func (p *paymentRequestImplement) Incoming(c *gin.Context) {
+	p.list(c, "payer_account_id")
+}
+
+// Outgoing lists the requests the current account has sent.
+func (p *paymentRequestImplement) Outgoing(c *gin.Context) {
+	p.list(c, "requester_account_id")
+}
+
+func (p *paymentRequestImplement) list(c *gin.Context, column string) {
+	accountID := c.GetInt64("account_id")
+	status := c.DefaultQuery("status", "")
+
+	var requests []model.PaymentRequest
+
+	query := p.db.Where(column+" = ?", accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at desc").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payment requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": requests,
+	})
+}
+
+// Accept pays the request through the regular transfer.
+func (p *paymentRequestImplement) Accept(c *gin.Context) {
+	var payload struct {
+		TransactionCategoryID *int64 `json:"transaction_category_id"`
+	}
+
+	// The body is optional
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	request, err := p.respond(c, "payer_account_id", func(tx *gorm.DB, request *model.PaymentRequest) error {
+		transaction, err := transferFunds(tx, request.PayerAccountID, request.RequesterAccountID, request.Amount, payload.TransactionCategoryID)
+		if err != nil {
+			return err
+		}
+		request.Status = model.PaymentRequestAccepted
+		request.TransactionID = &transaction.TransactionID
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment request paid",
+		"data":    request,
+	})
+}
+
+func (p *paymentRequestImplement) Decline(c *gin.Context) {
+	request, err := p.respond(c, "payer_account_id", func(tx *gorm.DB, request *model.PaymentRequest) error {
+		request.Status = model.PaymentRequestDeclined
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment request declined",
+		"data":    request,
+	})
+}
+
+func (p *paymentRequestImplement) Cancel(c *gin.Context) {
+	request, err := p.respond(c, "requester_account_id", func(tx *gorm.DB, request *model.PaymentRequest) error {
+		request.Status = model.PaymentRequestCancelled
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment request cancelled",
+		"data":    request,
+	})
+}
+
+// respond locks a pending request owned by the current account through column,
+// applies action to it and saves it. Errors are written to the response.
+func (p *paymentRequestImplement) respond(c *gin.Context, column string, action func(*gorm.DB, *model.PaymentRequest) error) (model.PaymentRequest, error) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var request model.PaymentRequest
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(column+" = ?", accountID).
+			First(&request, "payment_request_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		// Not swept by the expiry worker yet
+		if request.Status == model.PaymentRequestPending && time.Now().After(request.ExpiresAt) {
+			request.Status = model.PaymentRequestExpired
+		}
+		if request.Status != model.PaymentRequestPending {
+			return errPaymentRequestClosed
+		}
+
+		if err := action(tx, &request); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		request.RespondedAt = &now
+		return tx.Save(&request).Error
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment request not found"})
+	case errors.Is(err, errPaymentRequestClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment request is " + request.Status})
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	case errors.Is(err, errCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction category not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment request"})
+	}
+
+	return request, err
+}
+
+// ExpireStale marks every pending request past its expiry as expired. It is
+// run periodically from main.
+func (p *paymentRequestImplement) ExpireStale() (int64, error) {
+	result := p.db.Model(&model.PaymentRequest{}).
+		Where("status = ? AND expires_at < ?", model.PaymentRequestPending, time.Now()).
+		Update("status", model.PaymentRequestExpired)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,392 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInsufficientPocketBalance = errors.New("insufficient pocket balance")
+
+type PocketInterface interface {
+	Create(*gin.Context)
+	Read(*gin.Context)
+	Update(*gin.Context)
+	Delete(*gin.Context)
+	List(*gin.Context)
+	Deposit(*gin.Context)
+	Withdraw(*gin.Context)
+}
+
+type pocketImplement struct {
+	db *gorm.DB
+}
+
+func NewPocket(db *gorm.DB) PocketInterface {
+	return &pocketImplement{
+		db: db,
+	}
+}
+
+type pocketPayload struct {
+	Name           *string    `json:"name"`
+	TargetAmount   *int64     `json:"target_amount"`
+	TargetDate     *time.Time `json:"target_date"`
+	AutoSaveType   *string    `json:"auto_save_type"`
+	AutoSaveAmount *int64     `json:"auto_save_amount"`
+}
+
+// pocketProgress is a pocket with how far it is from its target.
+type pocketProgress struct {
+	model.Pocket
+	ProgressPercent *float64 `json:"progress_percent"`
+	RemainingAmount *int64   `json:"remaining_amount"`
+	DaysLeft        *int     `json:"days_left"`
+}
+
+func (p *pocketImplement) Create(c *gin.Context) {
+	var payload pocketPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	pocket := model.Pocket{
+		AccountID: c.GetInt64("account_id"),
+		CreatedAt: time.Now(),
+	}
+	if err := applyPocketPayload(&pocket, payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if pocket.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	if err := p.db.Create(&pocket).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pocket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    withProgress(pocket),
+	})
+}
+
+func (p *pocketImplement) Read(c *gin.Context) {
+	pocket, ok := p.ownPocket(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": withProgress(pocket),
+	})
+}
+
+func (p *pocketImplement) Update(c *gin.Context) {
+	var payload pocketPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	pocket, ok := p.ownPocket(c)
+	if !ok {
+		return
+	}
+
+	if err := applyPocketPayload(&pocket, payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if pocket.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	// Balance only changes through deposits and withdrawals
+	err := p.db.Model(&pocket).Select("name", "target_amount", "target_date", "auto_save_type", "auto_save_amount").
+		Updates(&pocket).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pocket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Update success",
+		"data":    withProgress(pocket),
+	})
+}
+
+// Delete closes a pocket, moving what is left in it back to the main balance.
+func (p *pocketImplement) Delete(c *gin.Context) {
+	pocket, ok := p.ownPocket(c)
+	if !ok {
+		return
+	}
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pocket, pocket.PocketID).Error; err != nil {
+			return err
+		}
+
+		if pocket.Balance > 0 {
+			if err := withdrawPocket(tx, &pocket, pocket.Balance); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		pocket.ClosedAt = &now
+		return tx.Model(&pocket).Update("closed_at", now).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close pocket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Delete success",
+		"data":    pocket,
+	})
+}
+
+func (p *pocketImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var pockets []model.Pocket
+	if err := p.db.Where("account_id = ? AND closed_at IS NULL", accountID).Order("created_at").Find(&pockets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pockets"})
+		return
+	}
+
+	data := []pocketProgress{}
+	for _, pocket := range pockets {
+		data = append(data, withProgress(pocket))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": data,
+	})
+}
+
+// Deposit moves money from the main balance into the pocket.
+func (p *pocketImplement) Deposit(c *gin.Context) {
+	p.move(c, depositPocket)
+}
+
+// Withdraw moves money from the pocket back to the main balance.
+func (p *pocketImplement) Withdraw(c *gin.Context) {
+	p.move(c, withdrawPocket)
+}
+
+func (p *pocketImplement) move(c *gin.Context, move func(*gorm.DB, *model.Pocket, int64) error) {
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	pocket, ok := p.ownPocket(c)
+	if !ok {
+		return
+	}
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		return move(tx, &pocket, payload.Amount)
+	})
+
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case errors.Is(err, errInsufficientPocketBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient pocket balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move money"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Move success",
+		"data":    withProgress(pocket),
+	})
+}
+
+// ownPocket loads the open pocket in the id parameter of the current account.
+func (p *pocketImplement) ownPocket(c *gin.Context) (model.Pocket, bool) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var pocket model.Pocket
+	err := p.db.First(&pocket, "pocket_id = ? AND account_id = ? AND closed_at IS NULL", id, accountID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return pocket, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return pocket, false
+	}
+
+	return pocket, true
+}
+
+func applyPocketPayload(pocket *model.Pocket, payload pocketPayload) error {
+	if payload.Name != nil {
+		pocket.Name = strings.TrimSpace(*payload.Name)
+	}
+	if payload.TargetAmount != nil {
+		if *payload.TargetAmount <= 0 {
+			return errors.New("target_amount must be greater than 0")
+		}
+		pocket.TargetAmount = payload.TargetAmount
+	}
+	if payload.TargetDate != nil {
+		pocket.TargetDate = payload.TargetDate
+	}
+	if payload.AutoSaveType != nil {
+		pocket.AutoSaveType = *payload.AutoSaveType
+	}
+	if payload.AutoSaveAmount != nil {
+		pocket.AutoSaveAmount = *payload.AutoSaveAmount
+	}
+
+	switch pocket.AutoSaveType {
+	case model.AutoSaveNone:
+		pocket.AutoSaveAmount = 0
+	case model.AutoSaveFixed, model.AutoSaveRoundUp:
+		// For round-ups the amount is the unit to round to, e.g. 1000
+		if pocket.AutoSaveAmount <= 0 {
+			return errors.New("auto_save_amount must be greater than 0")
+		}
+	default:
+		return errors.New("auto_save_type must be empty, fixed or roundup")
+	}
+
+	return nil
+}
+
+func withProgress(pocket model.Pocket) pocketProgress {
+	progress := pocketProgress{Pocket: pocket}
+
+	if pocket.TargetAmount != nil {
+		percent := math.Min(100, math.Round(float64(pocket.Balance)*10000/float64(*pocket.TargetAmount))/100)
+		remaining := *pocket.TargetAmount - pocket.Balance
+		if remaining < 0 {
+			remaining = 0
+		}
+		progress.ProgressPercent = &percent
+		progress.RemainingAmount = &remaining
+	}
+
+	if pocket.TargetDate != nil {
+		days := int(math.Ceil(time.Until(*pocket.TargetDate).Hours() / 24))
+		if days < 0 {
+			days = 0
+		}
+		progress.DaysLeft = &days
+	}
+
+	return progress
+}
+
+// depositPocket moves amount from the main balance of the owner into pocket.
+func depositPocket(tx *gorm.DB, pocket *model.Pocket, amount int64) error {
+	transaction := model.Transaction{
+		AccountID:     &pocket.AccountID,
+		FromAccountID: &pocket.AccountID,
+		Amount:        amount,
+		PocketID:      &pocket.PocketID,
+		Type:          model.TransactionTypePocket,
+	}
+	if err := postTransaction(tx, &transaction); err != nil {
+		return err
+	}
+
+	err := tx.Model(pocket).Update("balance", gorm.Expr("balance + ?", amount)).Error
+	if err != nil {
+		return err
+	}
+	pocket.Balance += amount
+	return nil
+}
+
+// withdrawPocket moves amount from pocket back to the main balance of the owner.
+func withdrawPocket(tx *gorm.DB, pocket *model.Pocket, amount int64) error {
+	result := tx.Model(&model.Pocket{}).
+		Where("pocket_id = ? AND balance >= ?", pocket.PocketID, amount).
+		Update("balance", gorm.Expr("balance - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientPocketBalance
+	}
+	pocket.Balance -= amount
+
+	transaction := model.Transaction{
+		AccountID:   &pocket.AccountID,
+		ToAccountID: &pocket.AccountID,
+		Amount:      amount,
+		PocketID:    &pocket.PocketID,
+		Type:        model.TransactionTypePocket,
+	}
+	return postTransaction(tx, &transaction)
+}
+
+// applyAutoSave sweeps money into the pockets of an account that have an
+// auto-save rule, after it sent amount. A sweep that the available balance
+// cannot cover is skipped; it never fails the transfer itself.
+func applyAutoSave(tx *gorm.DB, accountID, amount int64) error {
+	var pockets []model.Pocket
+	err := tx.Where("account_id = ? AND closed_at IS NULL AND auto_save_type <> ?", accountID, model.AutoSaveNone).
+		Order("pocket_id").
+		Find(&pockets).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range pockets {
+		pocket := &pockets[i]
+
+		var sweep int64
+		switch pocket.AutoSaveType {
+		case model.AutoSaveFixed:
+			sweep = pocket.AutoSaveAmount
+		case model.AutoSaveRoundUp:
+			sweep = (pocket.AutoSaveAmount - amount%pocket.AutoSaveAmount) % pocket.AutoSaveAmount
+		}
+		if sweep <= 0 {
+			continue
+		}
+
+		err := tx.Transaction(func(inner *gorm.DB) error {
+			return depositPocket(inner, pocket, sweep)
+		})
+		if err != nil && !errors.Is(err, errInsufficientBalance) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"godb/model"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProductInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Assign(*gin.Context)
+	Interest(*gin.Context)
+
+	RunInterest(now time.Time) error
+}
+
+type productImplement struct {
+	db *gorm.DB
+}
+
+func NewProduct(db *gorm.DB) ProductInterface {
+	return &productImplement{
+		db: db,
+	}
+}
+
+// Create adds a product with its rate tiers. Admin only.
+func (p *productImplement) Create(c *gin.Context) {
+	var payload struct {
+		Name     string `json:"name"`
+		DayCount string `json:"day_count"`
+		Tiers    []struct {
+			MinBalance int64   `json:"min_balance"`
+			AnnualRate float64 `json:"annual_rate"`
+		} `json:"tiers"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	product := model.AccountProduct{
+		Name:      strings.TrimSpace(payload.Name),
+		DayCount:  payload.DayCount,
+		CreatedAt: time.Now(),
+	}
+	if product.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if product.DayCount == "" {
+		product.DayCount = model.DayCountActual365
+	}
+	switch product.DayCount {
+	case model.DayCountActual365, model.DayCountActual360, model.DayCount30360:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "day_count must be ACT/365, ACT/360 or 30/360"})
+		return
+	}
+
+	if len(payload.Tiers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one rate tier is required"})
+		return
+	}
+	seen := map[int64]bool{}
+	for _, tier := range payload.Tiers {
+		if tier.MinBalance < 0 || tier.AnnualRate < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tier balance and rate must not be negative"})
+			return
+		}
+		if seen[tier.MinBalance] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tiers must have different min_balance"})
+			return
+		}
+		seen[tier.MinBalance] = true
+		product.Tiers = append(product.Tiers, model.ProductRateTier{
+			MinBalance: tier.MinBalance,
+			AnnualRate: tier.AnnualRate,
+		})
+	}
+
+	if err := p.db.Create(&product).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    product,
+	})
+}
+
+func (p *productImplement) List(c *gin.Context) {
+	var products []model.AccountProduct
+	err := p.db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_balance")
+	}).Find(&products).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": products,
+	})
+}
+
+// Assign puts an account on a product, or takes it off with a null
+// product_id. Admin only.
+func (p *productImplement) Assign(c *gin.Context) {
+	var payload struct {
+		AccountID int64  `json:"account_id"`
+		ProductID *int64 `json:"product_id"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.ProductID != nil {
+		var product model.AccountProduct
+		if err := p.db.First(&product, "product_id = ?", *payload.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+	}
+
+	// Interest is accrued from the day of the assignment on
+	var assignedAt *time.Time
+	if payload.ProductID != nil {
+		now := time.Now()
+		assignedAt = &now
+	}
+
+	result := p.db.Model(&model.Account{}).
+		Where("account_id = ?", payload.AccountID).
+		Updates(map[string]any{"product_id": payload.ProductID, "product_assigned_at": assignedAt})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign product"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Assign success",
+	})
+}
+
+// Interest shows the interest accrued but not yet paid out and the latest
+// daily accruals of the current account.
+func (p *productImplement) Interest(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var account model.Account
+	if err := p.db.First(&account, "account_id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	var accruals []model.InterestAccrual
+	err := p.db.Where("account_id = ?", accountID).
+		Order("accrual_date desc").
+		Limit(31).
+		Find(&accruals).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve accruals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"product_id":       account.ProductID,
+			"accrued_interest": account.AccruedInterest,
+			"accruals":         accruals,
+		},
+	})
+}
+
+// RunInterest accrues interest for the days up to the day before now that
+// were not accrued yet and capitalizes what was accrued in earlier months.
+// Both steps are idempotent, so it is safe to run it more than once a day.
+// It is run periodically from main.
+func (p *productImplement) RunInterest(now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if err := p.accrue(today.AddDate(0, 0, -1)); err != nil {
+		return err
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return p.capitalize(monthStart)
+}
+
+// accrue records the interest every account on a product earned on each day
+// up to until, computed on its balance at the end of that day. Days missed
+// while the job did not run are caught up, from the day after the last
+// accrual of the account but not before its product was assigned.
+func (p *productImplement) accrue(until time.Time) error {
+	var products []model.AccountProduct
+	if err := p.db.Preload("Tiers").Find(&products).Error; err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		var accounts []model.Account
+		err := p.db.Select("account_id", "product_assigned_at").
+			Where("product_id = ?", product.ProductID).
+			Find(&accounts).Error
+		if err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			from, err := p.accrualStart(account, until)
+			if err != nil {
+				return err
+			}
+			for day := from; !day.After(until); day = day.AddDate(0, 0, 1) {
+				if err := p.accrueAccount(account.AccountID, product, day); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// accrualStart returns the first day accrue has to record for account, in
+// the location of until. Without an accrual or an assignment date to go by
+// that is until itself.
+func (p *productImplement) accrualStart(account model.Account, until time.Time) (time.Time, error) {
+	loc := until.Location()
+
+	var from time.Time
+	if account.ProductAssignedAt != nil {
+		assigned := account.ProductAssignedAt.In(loc)
+		from = time.Date(assigned.Year(), assigned.Month(), assigned.Day(), 0, 0, 0, 0, loc)
+	}
+
+	var last struct {
+		Date *time.Time
+	}
+	err := p.db.Model(&model.InterestAccrual{}).
+		Select("max(accrual_date) AS date").
+		Where("account_id = ?", account.AccountID).
+		Scan(&last).Error
+	if err != nil {
+		return from, err
+	}
+	if last.Date != nil {
+		// Accrual dates are plain dates, so only the calendar day counts
+		next := time.Date(last.Date.Year(), last.Date.Month(), last.Date.Day()+1, 0, 0, 0, 0, loc)
+		if next.After(from) {
+			from = next
+		}
+	}
+
+	if from.IsZero() {
+		return until, nil
+	}
+	return from, nil
+}
+
+func (p *productImplement) accrueAccount(accountID int64, product model.AccountProduct, day time.Time) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		balance, err := balanceAt(tx, accountID, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+
+		accrual := model.InterestAccrual{
+			AccountID:   accountID,
+			AccrualDate: day,
+			Balance:     balance,
+			Amount:      dailyInterest(balance, product.Tiers, dayCountFactor(day, product.DayCount)),
+		}
+
+		// A second run for the same day does nothing
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&accrual)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&model.Account{}).
+			Where("account_id = ?", accountID).
+			Update("accrued_interest", gorm.Expr("accrued_interest + ?", accrual.Amount)).Error
+	})
+}
+
+// capitalize posts the whole units of interest accrued before monthStart as
+// a transaction, keeping the fraction for the next month.
+func (p *productImplement) capitalize(monthStart time.Time) error {
+	var accountIDs []int64
+	err := p.db.Model(&model.InterestAccrual{}).
+		Distinct("account_id").
+		Where("transaction_id IS NULL AND accrual_date < ?", monthStart).
+		Pluck("account_id", &accountIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, accountID := range accountIDs {
+		err := p.db.Transaction(func(tx *gorm.DB) error {
+			var account model.Account
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				First(&account, "account_id = ?", accountID).Error
+			if err != nil {
+				return err
+			}
+
+			amount := int64(math.Floor(account.AccruedInterest))
+			if amount <= 0 {
+				return nil
+			}
+
+			categoryID, err := systemCategoryID(tx, model.CategoryInterest)
+			if err != nil {
+				return err
+			}
+
+			transaction := model.Transaction{
+				AccountID:             &accountID,
+				ToAccountID:           &accountID,
+				TransactionCategoryID: categoryID,
+				Amount:                amount,
+				Type:                  model.TransactionTypeInterest,
+			}
+			if err := postTransaction(tx, &transaction); err != nil {
+				return err
+			}
+
+			err = tx.Model(&account).
+				Update("accrued_interest", gorm.Expr("accrued_interest - ?", amount)).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Model(&model.InterestAccrual{}).
+				Where("account_id = ? AND transaction_id IS NULL AND accrual_date < ?", accountID, monthStart).
+				Update("transaction_id", transaction.TransactionID).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dailyInterest applies every tier to the band of the balance it covers, so
+// with tiers at 0 and 10,000,000 only the part above ten million earns the
+// second rate.
+func dailyInterest(balance int64, tiers []model.ProductRateTier, factor float64) float64 {
+	sorted := append([]model.ProductRateTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinBalance < sorted[j].MinBalance
+	})
+
+	interest := 0.0
+	for i, tier := range sorted {
+		if balance <= tier.MinBalance {
+			break
+		}
+		upper := balance
+		if i+1 < len(sorted) && sorted[i+1].MinBalance < upper {
+			upper = sorted[i+1].MinBalance
+		}
+		interest += float64(upper-tier.MinBalance) * tier.AnnualRate / 100 * factor
+	}
+
+	return interest
+}
+
+// dayCountFactor is the fraction of a year that day counts for. Under 30/360
+// every month has 30 days: the 31st counts for nothing and the last day of
+// February makes up the missing days.
+func dayCountFactor(day time.Time, convention string) float64 {
+	switch convention {
+	case model.DayCountActual360:
+		return 1.0 / 360
+	case model.DayCount30360:
+		lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		switch {
+		case day.Day() == 31:
+			return 0
+		case day.Month() == time.February && day.Day() == lastDay:
+			return float64(30-lastDay+1) / 360
+		default:
+			return 1.0 / 360
+		}
+	default:
+		return 1.0 / 365
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"godb/qris"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+const qrCity = "JAKARTA"
+
+type QRInterface interface {
+	Generate(*gin.Context)
+	Pay(*gin.Context)
+}
+
+type qrImplement struct {
+	db *gorm.DB
+}
+
+func NewQR(db *gorm.DB) QRInterface {
+	return &qrImplement{
+		db: db,
+	}
+}
+
+// Generate builds a payload to receive money into the current account. With
+// ?format=png the QR code image is returned instead of JSON.
+func (q *qrImplement) Generate(c *gin.Context) {
+	var payload struct {
+		Amount    int64  `json:"amount"`
+		Reference string `json:"reference"`
+	}
+
+	// The body is optional, an empty one makes a static code
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must not be negative"})
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	var account model.Account
+	if err := q.db.First(&account, "account_id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	qrPayload, err := qris.Encode(qris.Payment{
+		AccountID: account.AccountID,
+		Name:      account.Name,
+		City:      qrCity,
+		Amount:    payload.Amount,
+		Reference: payload.Reference,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "png" {
+		image, err := qrcode.Encode(qrPayload, qrcode.Medium, 256)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", image)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"payload": qrPayload,
+		},
+	})
+}
+
+// Pay decodes a payload, checks it against the receiving account and
+// transfers the money. Static payloads need the amount in the request, for
+// dynamic ones it must be omitted or equal to the encoded amount.
+func (q *qrImplement) Pay(c *gin.Context) {
+	var payload struct {
+		Payload               string `json:"payload"`
+		Amount                int64  `json:"amount"`
+		TransactionCategoryID *int64 `json:"transaction_category_id"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	payment, err := qris.Decode(payload.Payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid QR payload", "details": err.Error()})
+		return
+	}
+
+	amount := payload.Amount
+	if payment.Amount > 0 {
+		if amount != 0 && amount != payment.Amount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount does not match the QR code"})
+			return
+		}
+		amount = payment.Amount
+	}
+	if amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	if payment.AccountID == currentAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pay your own QR code"})
+		return
+	}
+
+	// The name in the payload must still belong to the receiving account
+	var receiver model.Account
+	if err := q.db.First(&receiver, "account_id = ?", payment.AccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+		return
+	}
+	if payment.Name != "" && payment.Name != qris.MerchantName(receiver.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QR code does not match the target account"})
+		return
+	}
+
+	var transaction model.Transaction
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		transaction, err = transferFunds(tx, currentAccountID, payment.AccountID, amount, payload.TransactionCategoryID)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case errors.Is(err, errTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+		return
+	case errors.Is(err, errCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction category not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Transfer successful",
+		"data": gin.H{
+			"transaction": transaction,
+			"receiver":    maskName(receiver.Name),
+			"reference":   payment.Reference,
+		},
+	})
+}
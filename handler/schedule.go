@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"errors"
+	"godb/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxScheduleRetries = 5
+	scheduleRetryBase  = 15 * time.Minute
+)
+
+type ScheduleInterface interface {
+	Create(*gin.Context)
+	List(*gin.Context)
+	Cancel(*gin.Context)
+	History(*gin.Context)
+
+	RunDue() (int, error)
+}
+
+type scheduleImplement struct {
+	db *gorm.DB
+}
+
+func NewSchedule(db *gorm.DB) ScheduleInterface {
+	return &scheduleImplement{
+		db: db,
+	}
+}
+
+func (s *scheduleImplement) Create(c *gin.Context) {
+	var payload struct {
+		ToAccountID           int64      `json:"to_account_id"`
+		Amount                int64      `json:"amount"`
+		TransactionCategoryID *int64     `json:"transaction_category_id"`
+		Frequency             string     `json:"frequency"`
+		StartAt               time.Time  `json:"start_at"`
+		EndDate               *time.Time `json:"end_date"`
+		MaxOccurrences        *int       `json:"max_occurrences"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	if payload.Frequency == "" {
+		payload.Frequency = model.FrequencyOnce
+	}
+	switch payload.Frequency {
+	case model.FrequencyOnce, model.FrequencyDaily, model.FrequencyWeekly, model.FrequencyMonthly:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Frequency must be once, daily, weekly or monthly"})
+		return
+	}
+
+	if payload.StartAt.IsZero() || payload.StartAt.Before(time.Now().Add(-time.Minute)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_at must be in the future"})
+		return
+	}
+
+	if payload.EndDate != nil && payload.EndDate.Before(payload.StartAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be after start_at"})
+		return
+	}
+
+	if payload.MaxOccurrences != nil && *payload.MaxOccurrences <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_occurrences must be greater than 0"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	if payload.ToAccountID == currentAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot schedule a transfer to your own account"})
+		return
+	}
+
+	var targetAccount model.Account
+	if err := s.db.First(&targetAccount, "account_id = ?", payload.ToAccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+		return
+	}
+
+	order := model.ScheduledTransfer{
+		AccountID:             currentAccountID,
+		ToAccountID:           payload.ToAccountID,
+		TransactionCategoryID: payload.TransactionCategoryID,
+		Amount:                payload.Amount,
+		Frequency:             payload.Frequency,
+		StartAt:               payload.StartAt,
+		EndDate:               payload.EndDate,
+		MaxOccurrences:        payload.MaxOccurrences,
+		NextRunAt:             &payload.StartAt,
+		Status:                model.ScheduleStatusActive,
+		CreatedAt:             time.Now(),
+	}
+
+	if err := s.db.Create(&order).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scheduled transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    order,
+	})
+}
+
+func (s *scheduleImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	status := c.DefaultQuery("status", "")
+
+	var orders []model.ScheduledTransfer
+
+	query := s.db.Where("account_id = ?", accountID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at desc").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scheduled transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orders,
+	})
+}
+
+func (s *scheduleImplement) Cancel(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var order model.ScheduledTransfer
+	if err := s.db.First(&order, "scheduled_transfer_id = ? AND account_id = ?", id, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if order.Status != model.ScheduleStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scheduled transfer is already " + order.Status})
+		return
+	}
+
+	err := s.db.Model(&order).Updates(map[string]interface{}{
+		"status":      model.ScheduleStatusCancelled,
+		"next_run_at": nil,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cancel success",
+		"data":    order,
+	})
+}
+
+func (s *scheduleImplement) History(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var order model.ScheduledTransfer
+	if err := s.db.First(&order, "scheduled_transfer_id = ? AND account_id = ?", id, accountID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var executions []model.ScheduledTransferExecution
+	err := s.db.Where("scheduled_transfer_id = ?", order.ScheduledTransferID).
+		Order("executed_at desc").
+		Find(&executions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve execution history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": executions,
+	})
+}
+
+// RunDue executes every active scheduled transfer whose next run is due and
+// returns how many were attempted. It is run periodically from main.
+func (s *scheduleImplement) RunDue() (int, error) {
+	var ids []int64
+	err := s.db.Model(&model.ScheduledTransfer{}).
+		Where("status = ? AND next_run_at <= ?", model.ScheduleStatusActive, time.Now()).
+		Order("next_run_at").
+		Limit(100).
+		Pluck("scheduled_transfer_id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, id := range ids {
+		ran, err := s.runOne(id)
+		if err != nil {
+			// Keep going, one broken order must not hold up the others
+			log.Printf("running scheduled transfer %d failed: %v\n", id, err)
+			continue
+		}
+		if ran {
+			attempted++
+		}
+	}
+
+	return attempted, nil
+}
+
+// runOne executes a single due order in its own database transaction, so a
+// failing order never rolls back the others.
+func (s *scheduleImplement) runOne(id int64) (bool, error) {
+	ran := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var order model.ScheduledTransfer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_run_at <= ?", model.ScheduleStatusActive, now).
+			First(&order, "scheduled_transfer_id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Already picked up by another worker or cancelled meanwhile
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ran = true
+
+		execution := model.ScheduledTransferExecution{
+			ScheduledTransferID: order.ScheduledTransferID,
+			Occurrence:          order.Occurrences + 1,
+			Attempt:             order.RetryCount + 1,
+			ExecutedAt:          now,
+		}
+
+		var transaction model.Transaction
+		transferErr := tx.Transaction(func(inner *gorm.DB) error {
+			var err error
+			transaction, err = transferFunds(inner, order.AccountID, order.ToAccountID, order.Amount, order.TransactionCategoryID)
+			return err
+		})
+
+		switch {
+		case transferErr == nil:
+			execution.Status = model.ExecutionStatusSuccess
+			execution.TransactionID = &transaction.TransactionID
+			advanceSchedule(&order)
+		case errors.Is(transferErr, errTargetNotFound), errors.Is(transferErr, errAccountNotFound),
+			errors.Is(transferErr, errCategoryNotFound), errors.Is(transferErr, errInvalidTransaction):
+			// Retrying cannot fix these, give up on this occurrence right away
+			execution.Status = model.ExecutionStatusFailed
+			advanceSchedule(&order)
+		case order.RetryCount < maxScheduleRetries:
+			// Back off exponentially and try this occurrence again later, an
+			// insufficient balance or a failing fee or auto-save may pass
+			execution.Status = model.ExecutionStatusRetrying
+			order.RetryCount++
+			next := now.Add(scheduleRetryBase << (order.RetryCount - 1))
+			order.NextRunAt = &next
+		default:
+			// Give up on this occurrence and move on to the next one
+			execution.Status = model.ExecutionStatusFailed
+			advanceSchedule(&order)
+		}
+		if transferErr != nil {
+			execution.Error = transferErr.Error()
+		}
+
+		if err := tx.Create(&execution).Error; err != nil {
+			return err
+		}
+		return tx.Save(&order).Error
+	})
+
+	return ran, err
+}
+
+// advanceSchedule moves order past its current occurrence, completing it when
+// there is no next occurrence.
+func advanceSchedule(order *model.ScheduledTransfer) {
+	order.Occurrences++
+	order.RetryCount = 0
+
+	finished := order.Frequency == model.FrequencyOnce ||
+		(order.MaxOccurrences != nil && order.Occurrences >= *order.MaxOccurrences)
+
+	next := nthOccurrence(order.StartAt, order.Frequency, order.Occurrences)
+	if order.EndDate != nil && next.After(*order.EndDate) {
+		finished = true
+	}
+
+	if finished {
+		order.Status = model.ScheduleStatusCompleted
+		order.NextRunAt = nil
+		return
+	}
+	order.NextRunAt = &next
+}
+
+// nthOccurrence returns the n-th (zero based) run time of a schedule. Monthly
+// schedules keep the day of month of start, clamped to the end of shorter
+// months, so a transfer on the 31st runs on the 30th in April.
+func nthOccurrence(start time.Time, frequency string, n int) time.Time {
+	switch frequency {
+	case model.FrequencyDaily:
+		return start.AddDate(0, 0, n)
+	case model.FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case model.FrequencyMonthly:
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+		day := start.Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		return firstOfMonth.AddDate(0, 0, day-1)
+	default:
+		return start
+	}
+}
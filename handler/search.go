@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"godb/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchDocument is the text a transaction is found by, seen from the
+// searching account. It uses the simple configuration because names and
+// descriptions are mostly Indonesian, which PostgreSQL has no stemmer for.
+const searchDocument = `concat_ws(' ', t.description, cp.name, tc.name)`
+
+// searchHeadlineDocument is searchDocument with the HTML special characters
+// escaped, so only the <b> tags of ts_headline are markup in a highlight.
+const searchHeadlineDocument = `replace(replace(replace(` + searchDocument + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+// searchResult is a mutation matching a search, with its rank and the
+// matching part of its text as HTML, matches wrapped in <b> tags.
+type searchResult struct {
+	mutationEntry
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// Search finds the mutations of the current account whose description,
+// counterparty name or category name match ?q=, in web search syntax
+// ("quoted phrases", or, -excluded). The filters of MutationList narrow the
+// search down; results are ordered by relevance, then newest first.
+func (h *accountImplement) Search(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	limit, err := pageSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := accountLocation(h.db, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account information"})
+		return
+	}
+
+	filtered, ok := mutationQuery(c, h.db, accountID, loc)
+	if !ok {
+		return
+	}
+
+	var hits []struct {
+		TransactionID int64
+		Rank          float64
+		Highlight     string
+	}
+	query := h.db.Table(`"transaction" t`).
+		Select(`t.transaction_id,
+			ts_rank(to_tsvector('simple', `+searchDocument+`), websearch_to_tsquery('simple', ?)) AS rank,
+			ts_headline('simple', `+searchHeadlineDocument+`, websearch_to_tsquery('simple', ?), 'StartSel=<b>, StopSel=</b>, MaxFragments=2') AS highlight`, q, q).
+		Joins(`LEFT JOIN accounts cp ON cp.account_id = CASE WHEN t.from_account_id = ? THEN t.to_account_id ELSE t.from_account_id END`, accountID).
+		Joins(`LEFT JOIN transaction_categories tc ON tc.transaction_category_id = t.transaction_category_id`).
+		Where("t.transaction_id IN (?)", filtered.Model(&model.Transaction{}).Select("transaction_id")).
+		Where(`to_tsvector('simple', `+searchDocument+`) @@ websearch_to_tsquery('simple', ?)`, q)
+
+	// The indexed search_vector narrows the candidates down, the document as
+	// seen from this account decides. The vector holds the names of both
+	// sides, so it would drop rows when an excluded word is one of those
+	// names; any '-' in the query skips it, hyphenated words included.
+	if !strings.Contains(q, "-") {
+		query = query.Where("t.search_vector @@ websearch_to_tsquery('simple', ?)", q)
+	}
+
+	err = query.Order("rank DESC, t.transaction_date DESC, t.transaction_id DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search mutations"})
+		return
+	}
+
+	results := []searchResult{}
+	if len(hits) > 0 {
+		ids := make([]int64, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.TransactionID
+		}
+
+		var transactions []model.Transaction
+		if err := h.db.Where("transaction_id IN ?", ids).Find(&transactions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search mutations"})
+			return
+		}
+		entries, err := enrichMutations(h.db, accountID, transactions, loc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search mutations"})
+			return
+		}
+
+		byID := map[int64]mutationEntry{}
+		for _, entry := range entries {
+			byID[entry.TransactionID] = entry
+		}
+		for _, hit := range hits {
+			results = append(results, searchResult{
+				mutationEntry: byID[hit.TransactionID],
+				Rank:          hit.Rank,
+				Highlight:     hit.Highlight,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  results,
+		"limit": limit,
+	})
+}
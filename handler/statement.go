@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"godb/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StatementInterface interface {
+	List(*gin.Context)
+	Download(*gin.Context)
+
+	RunMonthEnd(now time.Time) (int, error)
+}
+
+type statementImplement struct {
+	db *gorm.DB
+}
+
+func NewStatement(db *gorm.DB) StatementInterface {
+	return &statementImplement{
+		db: db,
+	}
+}
+
+// categoryTotal is what an account received and sent in one category.
+type categoryTotal struct {
+	Name string
+	In   int64
+	Out  int64
+}
+
+func (s *statementImplement) List(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+
+	var statements []model.Statement
+	err := s.db.Omit("content").
+		Where("account_id = ?", accountID).
+		Order("period_start desc").
+		Find(&statements).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve statements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": statements,
+	})
+}
+
+func (s *statementImplement) Download(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var statement model.Statement
+	err := s.db.First(&statement, "statement_id = ? AND account_id = ?", id, accountID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.pdf"`, statement.Period))
+	c.Data(http.StatusOK, "application/pdf", statement.Content)
+}
+
+// RunMonthEnd generates the statement of the month before now for every
+// account opened before that month ended that does not have one yet, in the
+// timezone of the account, and returns how many were generated. An account
+// that fails is logged and retried on the next run, which is periodic from
+// main, without holding up the others.
+func (s *statementImplement) RunMonthEnd(now time.Time) (int, error) {
+	var accounts []model.Account
+	err := s.db.Select("account_id", "name", "timezone", "created_at").Order("account_id").Find(&accounts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	generated, failed := 0, 0
+	for _, account := range accounts {
+		loc, err := time.LoadLocation(account.Timezone)
+		if err != nil || account.Timezone == "" {
+			loc, _ = time.LoadLocation(defaultTimezone)
+		}
+
+		local := now.In(loc)
+		end := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		start := end.AddDate(0, -1, 0)
+		if !account.CreatedAt.Before(end) {
+			continue
+		}
+
+		var count int64
+		err = s.db.Model(&model.Statement{}).
+			Where("account_id = ? AND period = ?", account.AccountID, start.Format("2006-01")).
+			Count(&count).Error
+		if err == nil && count > 0 {
+			continue
+		}
+		if err == nil {
+			_, err = generateStatement(s.db, account, start, end)
+		}
+		if err != nil {
+			log.Printf("statement of account %d for %s failed: %v\n", account.AccountID, start.Format("2006-01"), err)
+			failed++
+			continue
+		}
+		generated++
+	}
+
+	if failed > 0 {
+		return generated, fmt.Errorf("%d statements failed", failed)
+	}
+	return generated, nil
+}
+
+// generateStatement renders and stores the statement of account for the
+// period [start, end).
+func generateStatement(db *gorm.DB, account model.Account, start, end time.Time) (model.Statement, error) {
+	loc := start.Location()
+	statement := model.Statement{
+		AccountID:       account.AccountID,
+		StatementNumber: fmt.Sprintf("STM/%s/%08d", start.Format("200601"), account.AccountID),
+		Period:          start.Format("2006-01"),
+		PeriodStart:     start,
+		PeriodEnd:       end,
+		CreatedAt:       time.Now(),
+	}
+
+	opening, err := balanceAt(db, account.AccountID, start)
+	if err != nil {
+		return statement, err
+	}
+	statement.OpeningBalance = opening
+
+	var transactions []model.Transaction
+	err = db.Where("from_account_id = ? OR to_account_id = ?", account.AccountID, account.AccountID).
+		Where("status IN ? AND transaction_date >= ? AND transaction_date < ?", movedStatuses, start, end).
+		Order("transaction_date, transaction_id").
+		Find(&transactions).Error
+	if err != nil {
+		return statement, err
+	}
+
+	// Enriched in batches, as every batch binds its transaction ids
+	entries := make([]mutationEntry, 0, len(transactions))
+	for i := 0; i < len(transactions); i += exportBatchSize {
+		batch, err := enrichMutations(db, account.AccountID, transactions[i:min(i+exportBatchSize, len(transactions))], loc)
+		if err != nil {
+			return statement, err
+		}
+		entries = append(entries, batch...)
+	}
+
+	// The running balance starts from the opening balance, so the statement
+	// adds up even if money moved while it was generated
+	balance := opening
+	totals := map[string]*categoryTotal{}
+	for i := range entries {
+		entry := &entries[i]
+		balance += entry.SignedAmount
+		entry.BalanceAfter = balance
+
+		name := entry.CategoryName
+		if name == "" {
+			name = "Uncategorized"
+		}
+		total, ok := totals[name]
+		if !ok {
+			total = &categoryTotal{Name: name}
+			totals[name] = total
+		}
+		if entry.SignedAmount >= 0 {
+			total.In += entry.SignedAmount
+			statement.TotalIn += entry.SignedAmount
+		} else {
+			total.Out -= entry.SignedAmount
+			statement.TotalOut -= entry.SignedAmount
+		}
+	}
+	statement.ClosingBalance = balance
+
+	content, err := renderStatement(statement, account, entries, totals)
+	if err != nil {
+		return statement, err
+	}
+	statement.Content = content
+
+	// Another worker may have generated the same period meanwhile
+	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&statement).Error
+	return statement, err
+}
+
+func renderStatement(statement model.Statement, account model.Account, entries []mutationEntry, totals map[string]*categoryTotal) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%s - page %d of {nb}", statement.StatementNumber, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	amount := func(v int64) string { return formatAmount(v, "id") }
+	lastDay := statement.PeriodEnd.AddDate(0, 0, -1)
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "Account Statement", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range [][2]string{
+		{"Statement number", statement.StatementNumber},
+		{"Account", fmt.Sprintf("%d - %s", account.AccountID, account.Name)},
+		{"Period", statement.PeriodStart.Format("02 Jan 2006") + " - " + lastDay.Format("02 Jan 2006")},
+		{"Opening balance", amount(statement.OpeningBalance)},
+	} {
+		pdf.CellFormat(40, 6, line[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, tr(line[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{30, 60, 30, 23, 23, 24}
+	headers := []string{"Date", "Description", "Category", "Debit", "Credit", "Balance"}
+	aligns := []string{"L", "L", "L", "R", "R", "R"}
+
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(230, 230, 230)
+	for i, header := range headers {
+		pdf.CellFormat(widths[i], 7, header, "1", 0, aligns[i], true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 8)
+	for _, entry := range entries {
+		description := entry.CounterpartyName
+		if description == "" {
+			description = entry.Type
+		}
+		if description == "" {
+			description = "-"
+		}
+
+		debit, credit := "", ""
+		if entry.SignedAmount < 0 {
+			debit = amount(-entry.SignedAmount)
+		} else {
+			credit = amount(entry.SignedAmount)
+		}
+
+		cells := []string{
+			entry.TransactionDate.Format("02/01/2006 15:04"),
+			tr(description),
+			tr(entry.CategoryName),
+			debit,
+			credit,
+			amount(entry.BalanceAfter),
+		}
+		for i, cell := range cells {
+			pdf.CellFormat(widths[i], 6, cell, "1", 0, aligns[i], false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if len(entries) == 0 {
+		pdf.CellFormat(190, 6, "No transactions in this period", "1", 1, "C", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "B", 10)
+	for _, line := range [][2]string{
+		{"Total credit", amount(statement.TotalIn)},
+		{"Total debit", amount(statement.TotalOut)},
+		{"Closing balance", amount(statement.ClosingBalance)},
+	} {
+		pdf.CellFormat(40, 6, line[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, line[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	if len(totals) > 0 {
+		pdf.CellFormat(0, 7, "Totals by category", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(70, 7, "Category", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(40, 7, "Credit", "1", 0, "R", true, 0, "")
+		pdf.CellFormat(40, 7, "Debit", "1", 1, "R", true, 0, "")
+
+		pdf.SetFont("Helvetica", "", 9)
+		for _, name := range sortedKeys(totals) {
+			total := totals[name]
+			pdf.CellFormat(70, 6, tr(total.Name), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(40, 6, amount(total.In), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(40, 6, amount(total.Out), "1", 1, "R", false, 0, "")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
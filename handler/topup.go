@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"godb/gateway"
+	"godb/model"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	topUpIntentDuration = 24 * time.Hour
+	webhookTolerance    = 5 * time.Minute
+	maxWebhookBody      = 1 << 20
+)
+
+var errAmountMismatch = errors.New("paid amount does not match the intent")
+
+type TopUpInterface interface {
+	Create(*gin.Context)
+	Read(*gin.Context)
+	Webhook(*gin.Context)
+	FakePay(*gin.Context)
+
+	ExpireStale() (int64, error)
+}
+
+type topUpImplement struct {
+	db      *gorm.DB
+	gateway gateway.Gateway
+	secret  []byte
+}
+
+// NewTopUp collects top-ups through gw and trusts webhooks signed with secret.
+func NewTopUp(db *gorm.DB, gw gateway.Gateway, secret []byte) TopUpInterface {
+	return &topUpImplement{
+		db:      db,
+		gateway: gw,
+		secret:  secret,
+	}
+}
+
+// Create starts a top-up of the current account and returns the checkout
+// where it is paid. The balance does not change until the gateway confirms.
+func (h *topUpImplement) Create(c *gin.Context) {
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+
+	accountID := c.GetInt64("account_id")
+	quote, err := quoteFee(h.db, accountID, model.FeeOperationTopUp, payload.Amount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute fee"})
+		return
+	}
+	if quote.Fee >= payload.Amount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount does not cover the top-up fee"})
+		return
+	}
+
+	now := time.Now()
+	intent := model.TopUpIntent{
+		AccountID: accountID,
+		Amount:    payload.Amount,
+		Status:    model.TopUpIntentPending,
+		ExpiresAt: now.Add(topUpIntentDuration),
+		CreatedAt: now,
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&intent).Error; err != nil {
+			return err
+		}
+
+		checkout, err := h.gateway.CreateCheckout(intent.TopUpIntentID, intent.Amount)
+		if err != nil {
+			return err
+		}
+
+		intent.CheckoutReference = checkout.Reference
+		intent.CheckoutURL = checkout.URL
+		return tx.Model(&intent).Updates(map[string]any{
+			"checkout_reference": checkout.Reference,
+			"checkout_url":       checkout.URL,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create top-up"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Create success",
+		"data":    intent,
+		"fee":     quote,
+	})
+}
+
+func (h *topUpImplement) Read(c *gin.Context) {
+	accountID := c.GetInt64("account_id")
+	id := c.Param("id")
+
+	var intent model.TopUpIntent
+	err := h.db.First(&intent, "top_up_intent_id = ? AND account_id = ?", id, accountID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": intent,
+	})
+}
+
+// Webhook receives payment outcomes from the gateway. Only signed, recent
+// events are accepted and every event is processed at most once.
+func (h *topUpImplement) Webhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := gateway.Verify(h.secret, c.GetHeader(gateway.SignatureHeader), body, webhookTolerance, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var event gateway.Event
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event"})
+		return
+	}
+
+	replayed := false
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		received := model.GatewayEvent{
+			EventID:    event.ID,
+			Type:       event.Type,
+			ReceivedAt: time.Now(),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&received)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			replayed = true
+			return nil
+		}
+
+		var intent model.TopUpIntent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&intent, "checkout_reference = ?", event.Data.Reference).Error
+		if err != nil {
+			return err
+		}
+
+		// Money the gateway collected is credited even if the intent expired
+		if intent.Status != model.TopUpIntentPending && intent.Status != model.TopUpIntentExpired {
+			return nil
+		}
+
+		switch event.Type {
+		case gateway.EventPaymentSucceeded:
+			if event.Data.Amount != intent.Amount {
+				return errAmountMismatch
+			}
+			return creditTopUp(tx, &intent)
+		case gateway.EventPaymentFailed:
+			return tx.Model(&intent).Update("status", model.TopUpIntentFailed).Error
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown checkout reference"})
+		return
+	case errors.Is(err, errAmountMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Paid amount does not match the top-up"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+		return
+	}
+
+	if replayed {
+		c.JSON(http.StatusOK, gin.H{"message": "Event already processed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Event processed"})
+}
+
+// FakePay pays a checkout of the bundled fake gateway, which then calls
+// Webhook. With ?result=failed the payment fails instead.
+func (h *topUpImplement) FakePay(c *gin.Context) {
+	fake, ok := h.gateway.(*gateway.Fake)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	event, err := fake.Pay(c.Param("reference"), c.Query("result") != "failed")
+	if errors.Is(err, gateway.ErrUnknownCheckout) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown checkout reference"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver webhook", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payment sent",
+		"data":    event,
+	})
+}
+
+// ExpireStale marks every pending intent past its expiry as expired. It is
+// run periodically from main.
+func (h *topUpImplement) ExpireStale() (int64, error) {
+	result := h.db.Model(&model.TopUpIntent{}).
+		Where("status = ? AND expires_at < ?", model.TopUpIntentPending, time.Now()).
+		Update("status", model.TopUpIntentExpired)
+	return result.RowsAffected, result.Error
+}
+
+// creditTopUp credits a paid intent, less the top-up fee.
+func creditTopUp(tx *gorm.DB, intent *model.TopUpIntent) error {
+	topUp := model.Transaction{
+		AccountID:   &intent.AccountID,
+		ToAccountID: &intent.AccountID,
+		Amount:      intent.Amount,
+		Type:        model.TransactionTypeTopUp,
+	}
+	if err := postTransaction(tx, &topUp); err != nil {
+		return err
+	}
+
+	if _, err := chargeFee(tx, intent.AccountID, model.FeeOperationTopUp, intent.Amount, topUp.TransactionID, nil); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	intent.Status = model.TopUpIntentPaid
+	intent.TransactionID = &topUp.TransactionID
+	intent.PaidAt = &now
+	return tx.Save(intent).Error
+}
@@ -1,17 +1,29 @@
 package handler
 
 import (
+	"errors"
 	"godb/model"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errNotReversible   = errors.New("transaction cannot be reversed")
+	errAlreadyReversed = errors.New("transaction already fully reversed")
+	errRefundTooLarge  = errors.New("refund exceeds the remaining amount")
 )
 
 type TransactionHandlerInterface interface {
 	NewTransaction(*gin.Context)
 	TransactionList(*gin.Context)
+	Reverse(*gin.Context)
+	Refund(*gin.Context)
 }
 
 type transactionHandler struct {
@@ -24,6 +36,8 @@ func NewTransactionHandler(db *gorm.DB) TransactionHandlerInterface {
 	}
 }
 
+// NewTransaction posts a transaction of any type with the balances moving
+// along, for corrections by the back office. Admin only.
 func (t *transactionHandler) NewTransaction(c *gin.Context) {
 	var payload model.Transaction
 
@@ -34,13 +48,41 @@ func (t *transactionHandler) NewTransaction(c *gin.Context) {
 		return
 	}
 
+	// Holds, refunds and pockets keep their own state next to the row, so a
+	// posting made here is always a plain completed one
+	payload.TransactionID = 0
 	payload.TransactionDate = time.Now()
+	payload.Status = model.TransactionStatusCompleted
+	payload.HoldAmount = 0
+	payload.FundsHeld = false
+	payload.ExpiresAt = nil
+	payload.RefundedAmount = 0
+	payload.RelatedTransactionID = nil
+	payload.PocketID = nil
+	if payload.AccountID == nil {
+		payload.AccountID = payload.FromAccountID
+		if payload.AccountID == nil {
+			payload.AccountID = payload.ToAccountID
+		}
+	}
 
-	// Insert the transaction record into the database
-	if err := t.db.Create(&payload).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if msg := validateTransaction(payload); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		return postTransaction(tx, &payload)
+	})
+	switch {
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+		return
+	case errors.Is(err, errAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
 		return
 	}
 
@@ -51,22 +93,144 @@ func (t *transactionHandler) NewTransaction(c *gin.Context) {
 	})
 }
 
+// TransactionList pages through the transactions of an account. Only its
+// owner or an admin can list them.
 func (t *transactionHandler) TransactionList(c *gin.Context) {
-	accountID := c.Param("account_id")
-
-	// Prepare a slice to hold the results
-	var transactions []model.Transaction
+	accountID, err := strconv.ParseInt(c.Param("account_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account_id"})
+		return
+	}
+	if c.GetString("role") != model.RoleAdmin && accountID != c.GetInt64("account_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return
+	}
 
 	// Query the database to get the latest transactions for the given account ID
-	if err := t.db.Where("account_id = ?", accountID).Order("transaction_date DESC").Limit(5).Find(&transactions).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	transactions, next, limit, ok := transactionPage(c, t.db.Where("account_id = ?", accountID))
+	if !ok {
 		return
 	}
 
 	// Success response
+	c.JSON(http.StatusOK, listEnvelope{Data: transactions, NextCursor: next, Limit: limit})
+}
+
+// Reverse undoes whatever is left of a transfer. Admin only.
+func (t *transactionHandler) Reverse(c *gin.Context) {
+	compensation, err := t.reverse(c.Param("id"), 0, nil)
+	if err != nil {
+		reversalError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": transactions,
+		"message": "Transaction reversed",
+		"data":    compensation,
 	})
 }
+
+// Refund lets the receiver of a transfer send all or part of it back.
+func (t *transactionHandler) Refund(c *gin.Context) {
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+
+	// The body is optional, an empty one means the full amount
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if payload.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must not be negative"})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	compensation, err := t.reverse(c.Param("id"), payload.Amount, &currentAccountID)
+	if err != nil {
+		reversalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Refund successful",
+		"data":    compensation,
+	})
+}
+
+// reverse posts a compensating transaction that moves amount (or everything
+// not yet refunded when amount is 0) back from the receiver to the sender.
+// When receiverID is set only that account may trigger it.
+func (t *transactionHandler) reverse(id string, amount int64, receiverID *int64) (model.Transaction, error) {
+	var compensation model.Transaction
+
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		var original model.Transaction
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&original, "transaction_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+
+		if receiverID != nil && (original.ToAccountID == nil || *original.ToAccountID != *receiverID) {
+			return gorm.ErrRecordNotFound
+		}
+
+		// Only transfers between two accounts here can be undone; other types
+		// are settled by their own feature, such as a rail or an agent
+		moved := original.Status == model.TransactionStatusCompleted || original.Status == model.TransactionStatusCaptured
+		if original.Type != model.TransactionTypeTransfer || !moved || original.FromAccountID == nil || original.ToAccountID == nil || original.RelatedTransactionID != nil {
+			return errNotReversible
+		}
+
+		remaining := original.Amount - original.RefundedAmount
+		if remaining <= 0 {
+			return errAlreadyReversed
+		}
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount > remaining {
+			return errRefundTooLarge
+		}
+
+		compensation = model.Transaction{
+			AccountID:             original.ToAccountID,
+			FromAccountID:         original.ToAccountID,
+			ToAccountID:           original.FromAccountID,
+			TransactionCategoryID: original.TransactionCategoryID,
+			Amount:                amount,
+			RelatedTransactionID:  &original.TransactionID,
+			Type:                  model.TransactionTypeReversal,
+		}
+		if err := postTransaction(tx, &compensation); err != nil {
+			return err
+		}
+
+		return tx.Model(&original).
+			Update("refunded_amount", gorm.Expr("refunded_amount + ?", amount)).Error
+	})
+
+	return compensation, err
+}
+
+func reversalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+	case errors.Is(err, errNotReversible):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction cannot be reversed"})
+	case errors.Is(err, errAlreadyReversed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction already fully reversed"})
+	case errors.Is(err, errRefundTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the remaining refundable amount"})
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	case errors.Is(err, errInvalidTransaction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse transaction"})
+	}
+}
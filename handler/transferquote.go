@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"godb/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const transferQuoteTTL = 5 * time.Minute
+
+var (
+	errInvalidAmount       = errors.New("amount must be greater than 0")
+	errSameAccount         = errors.New("cannot transfer to the same account")
+	errBeneficiaryNotFound = errors.New("beneficiary not found")
+	errBeneficiaryMismatch = errors.New("to_account_id does not match the beneficiary")
+	errCategoryNotFound    = errors.New("transaction category not found")
+	errInvalidQuote        = errors.New("invalid or expired quote")
+	errQuoteUsed           = errors.New("quote already used")
+)
+
+// transferPlan is the outcome of every check a transfer goes through.
+type transferPlan struct {
+	FromAccountID         int64    `json:"from_account_id"`
+	ToAccountID           int64    `json:"to_account_id"`
+	TargetName            string   `json:"target_name"`
+	Amount                int64    `json:"amount"`
+	TransactionCategoryID *int64   `json:"transaction_category_id"`
+	Fee                   feeQuote `json:"fee"`
+	TotalDebit            int64    `json:"total_debit"`
+	AvailableAfter        int64    `json:"available_after"`
+}
+
+// transferQuote is the signed and short-lived form of a transferPlan.
+type transferQuote struct {
+	jwt.RegisteredClaims
+	FromAccountID         int64  `json:"from_account_id"`
+	ToAccountID           int64  `json:"to_account_id"`
+	Amount                int64  `json:"amount"`
+	TransactionCategoryID *int64 `json:"transaction_category_id"`
+	Fee                   int64  `json:"fee"`
+}
+
+// Preview runs the checks of Transfer without moving money and returns a
+// quote that Transfer executes exactly as quoted within five minutes.
+func (h *accountImplement) Preview(c *gin.Context) {
+	var payload struct {
+		ToAccountID           int64  `json:"to_account_id"`
+		BeneficiaryID         *int64 `json:"beneficiary_id"`
+		Amount                int64  `json:"amount"`
+		TransactionCategoryID *int64 `json:"transaction_category_id"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	currentAccountID := c.GetInt64("account_id")
+	toAccountID, err := resolveBeneficiary(h.db, currentAccountID, payload.ToAccountID, payload.BeneficiaryID)
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+
+	plan, err := planTransfer(h.db, currentAccountID, toAccountID, payload.Amount, payload.TransactionCategoryID, nil)
+	if err != nil {
+		transferError(c, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(transferQuoteTTL)
+	quote, err := h.signQuote(plan, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign quote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"plan":       plan,
+			"quote":      quote,
+			"expires_at": expiresAt,
+		},
+	})
+}
+
+// planTransfer checks the amount, the target account, which must not be the
+// sender, the category and that the sender can pay the amount plus the fee.
+// A quotedFee replaces the fee of the current fee schedule.
+func planTransfer(db *gorm.DB, fromAccountID, toAccountID, amount int64, categoryID *int64, quotedFee *int64) (transferPlan, error) {
+	plan := transferPlan{
+		FromAccountID:         fromAccountID,
+		ToAccountID:           toAccountID,
+		Amount:                amount,
+		TransactionCategoryID: categoryID,
+	}
+
+	if amount <= 0 {
+		return plan, errInvalidAmount
+	}
+
+	if fromAccountID == toAccountID {
+		return plan, errSameAccount
+	}
+
+	var current model.Account
+	if err := db.First(&current, "account_id = ?", fromAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return plan, errAccountNotFound
+		}
+		return plan, err
+	}
+
+	var target model.Account
+	if err := db.First(&target, "account_id = ?", toAccountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return plan, errTargetNotFound
+		}
+		return plan, err
+	}
+	plan.TargetName = maskName(target.Name)
+
+	if err := checkCategory(db, categoryID); err != nil {
+		return plan, err
+	}
+
+	fee, err := quoteFee(db, fromAccountID, model.FeeOperationTransfer, amount)
+	if err != nil {
+		return plan, err
+	}
+	if quotedFee != nil {
+		fee.Fee = *quotedFee
+	}
+	plan.Fee = fee
+
+	plan.TotalDebit = amount + fee.Fee
+	plan.AvailableAfter = current.Balance - current.HeldBalance - plan.TotalDebit
+	if plan.AvailableAfter < 0 {
+		return plan, errInsufficientBalance
+	}
+
+	return plan, nil
+}
+
+// resolveBeneficiary returns the target account of a transfer, which is
+// either given directly or through a saved beneficiary of the sender.
+func resolveBeneficiary(db *gorm.DB, accountID, toAccountID int64, beneficiaryID *int64) (int64, error) {
+	if beneficiaryID == nil {
+		return toAccountID, nil
+	}
+
+	var beneficiary model.Beneficiary
+	err := db.First(&beneficiary, "beneficiary_id = ? AND account_id = ?", *beneficiaryID, accountID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errBeneficiaryNotFound
+		}
+		return 0, err
+	}
+	if toAccountID != 0 && toAccountID != beneficiary.TargetAccountID {
+		return 0, errBeneficiaryMismatch
+	}
+
+	return beneficiary.TargetAccountID, nil
+}
+
+func (h *accountImplement) signQuote(plan transferPlan, expiresAt time.Time) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	claims := transferQuote{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(id),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		FromAccountID:         plan.FromAccountID,
+		ToAccountID:           plan.ToAccountID,
+		Amount:                plan.Amount,
+		TransactionCategoryID: plan.TransactionCategoryID,
+		Fee:                   plan.Fee.Fee,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.quoteKey())
+}
+
+// parseQuote verifies a quote and that it was issued to accountID.
+func (h *accountImplement) parseQuote(tokenString string, accountID int64) (transferQuote, error) {
+	var claims transferQuote
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return h.quoteKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.ID == "" || claims.FromAccountID != accountID {
+		return claims, errInvalidQuote
+	}
+
+	return claims, nil
+}
+
+// quoteKey is derived from the signing key so a quote can never pass as a
+// login token and the other way around.
+func (h *accountImplement) quoteKey() []byte {
+	return []byte(fmt.Sprintf("%s:transfer-quote", h.signingKey))
+}
+
+// markQuoteUsed fails with errQuoteUsed when the quote was executed before.
+func markQuoteUsed(tx *gorm.DB, quote transferQuote, transactionID int64) error {
+	used := model.UsedTransferQuote{
+		QuoteID:       quote.ID,
+		AccountID:     quote.FromAccountID,
+		TransactionID: transactionID,
+		UsedAt:        time.Now(),
+	}
+
+	// The primary key keeps two concurrent executions from both going through
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&used)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errQuoteUsed
+	}
+	return nil
+}
+
+func transferError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
+	case errors.Is(err, errSameAccount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer to the same account"})
+	case errors.Is(err, errInvalidTransaction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction"})
+	case errors.Is(err, errAccountNotFound):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve current account"})
+	case errors.Is(err, errTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target account not found"})
+	case errors.Is(err, errBeneficiaryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Beneficiary not found"})
+	case errors.Is(err, errBeneficiaryMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to_account_id does not match the beneficiary"})
+	case errors.Is(err, errCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction category not found"})
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	case errors.Is(err, errInvalidQuote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired quote"})
+	case errors.Is(err, errQuoteUsed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Quote already used"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete transfer"})
+	}
+}
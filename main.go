@@ -1,10 +1,16 @@
 package main
 
 import (
+	"godb/gateway"
 	"godb/handler"
 	"godb/middleware"
+	"godb/model"
+	"godb/rail"
+	"godb/storage"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -48,18 +54,26 @@ func main() {
 	authRoute.POST("/upsert", authHandler.Upsert)
 	authRoute.POST("/change-password", middleware.AuthMiddleware(signingKey), authHandler.ChangePassword)
 
-	accountHandler := handler.NewAccount(db)
+	accountHandler := handler.NewAccount(db, []byte(signingKey))
 	accountRoutes := r.Group("/account")
 	accountRoutes.POST("/create", accountHandler.Create)
-	accountRoutes.GET("/read/:id", accountHandler.Read)
-	accountRoutes.PATCH("/update/:id", accountHandler.Update)
-	accountRoutes.DELETE("/delete/:id", accountHandler.Delete)
-	accountRoutes.GET("/list", accountHandler.List)
-	accountRoutes.POST("/topup", accountHandler.TopUp)
+	accountRoutes.GET("/read/:id", middleware.AuthMiddleware(signingKey), middleware.AdminMiddleware(), accountHandler.Read)
+	accountRoutes.PATCH("/update/:id", middleware.AuthMiddleware(signingKey), accountHandler.Update)
+	accountRoutes.DELETE("/delete/:id", middleware.AuthMiddleware(signingKey), accountHandler.Delete)
+	accountRoutes.GET("/list", middleware.AuthMiddleware(signingKey), middleware.AdminMiddleware(), accountHandler.List)
 	accountRoutes.GET("/balance", middleware.AuthMiddleware(signingKey), accountHandler.Balance)
 	accountRoutes.GET("/my", middleware.AuthMiddleware(signingKey), accountHandler.My)
 	accountRoutes.POST("/transfer", middleware.AuthMiddleware(signingKey), accountHandler.Transfer)
+	accountRoutes.POST("/transfer/preview", middleware.AuthMiddleware(signingKey), accountHandler.Preview)
 	accountRoutes.GET("/mutation", middleware.AuthMiddleware(signingKey), accountHandler.MutationList)
+	accountRoutes.GET("/mutation/export", middleware.AuthMiddleware(signingKey), accountHandler.Export)
+	accountRoutes.GET("/mutation/search", middleware.AuthMiddleware(signingKey), accountHandler.Search)
+
+	accountRoutes.GET("/lookup/:id", middleware.AuthMiddleware(signingKey), accountHandler.Lookup)
+
+	batchHandler := handler.NewBatch(db)
+	accountRoutes.POST("/transfer/batch", middleware.AuthMiddleware(signingKey), batchHandler.Create)
+	accountRoutes.GET("/transfer/batch/:id", middleware.AuthMiddleware(signingKey), batchHandler.Read)
 
 	transcatHandler := handler.NewTransactionCategories(db)
 	transcatRoutes := r.Group("/transcat")
@@ -71,12 +85,232 @@ func main() {
 
 	transactionHandler := handler.NewTransactionHandler(db)
 	transactionRoutes := r.Group("/transaction")
-	transactionRoutes.POST("/new", transactionHandler.NewTransaction)
-	transactionRoutes.GET("/list/:account_id", transactionHandler.TransactionList)
+	transactionRoutes.POST("/new", middleware.AuthMiddleware(signingKey), middleware.AdminMiddleware(), transactionHandler.NewTransaction)
+	transactionRoutes.GET("/list/:account_id", middleware.AuthMiddleware(signingKey), transactionHandler.TransactionList)
+	transactionRoutes.POST("/:id/reverse", middleware.AuthMiddleware(signingKey), middleware.AdminMiddleware(), transactionHandler.Reverse)
+	transactionRoutes.POST("/:id/refund", middleware.AuthMiddleware(signingKey), transactionHandler.Refund)
+
+	importHandler := handler.NewImport(db)
+	transactionRoutes.POST("/import", middleware.AuthMiddleware(signingKey), middleware.AdminMiddleware(), importHandler.Import)
+
+	attachmentDir := os.Getenv("ATTACHMENT_DIR")
+	if attachmentDir == "" {
+		attachmentDir = "attachments"
+	}
+	blobStore, err := storage.NewLocal(attachmentDir)
+	if err != nil {
+		log.Fatal("failed to open attachment storage:", err)
+	}
+
+	annotationHandler := handler.NewAnnotation(db, blobStore)
+	annotationRoutes := transactionRoutes.Group("/:id", middleware.AuthMiddleware(signingKey))
+	annotationRoutes.GET("/annotation", annotationHandler.Read)
+	annotationRoutes.PATCH("/note", annotationHandler.SetNote)
+	annotationRoutes.PATCH("/tags", annotationHandler.SetTags)
+	annotationRoutes.POST("/attachment", annotationHandler.Upload)
+	annotationRoutes.GET("/attachment/list", annotationHandler.Attachments)
+	annotationRoutes.GET("/attachment/:attachment_id", annotationHandler.Download)
+	annotationRoutes.DELETE("/attachment/:attachment_id", annotationHandler.DeleteAttachment)
+	r.GET("/tag/list", middleware.AuthMiddleware(signingKey), annotationHandler.Tags)
+
+	holdHandler := handler.NewHold(db)
+	holdRoutes := r.Group("/hold", middleware.AuthMiddleware(signingKey))
+	holdRoutes.POST("/authorize", holdHandler.Authorize)
+	holdRoutes.POST("/capture/:id", holdHandler.Capture)
+	holdRoutes.POST("/void/:id", holdHandler.Void)
+	holdRoutes.GET("/list", holdHandler.List)
+
+	beneficiaryHandler := handler.NewBeneficiary(db)
+	beneficiaryRoutes := r.Group("/beneficiary", middleware.AuthMiddleware(signingKey))
+	beneficiaryRoutes.POST("/create", beneficiaryHandler.Create)
+	beneficiaryRoutes.GET("/list", beneficiaryHandler.List)
+	beneficiaryRoutes.PATCH("/update/:id", beneficiaryHandler.Update)
+	beneficiaryRoutes.DELETE("/delete/:id", beneficiaryHandler.Delete)
+
+	paymentRequestHandler := handler.NewPaymentRequest(db)
+	paymentRequestRoutes := r.Group("/payment-request", middleware.AuthMiddleware(signingKey))
+	paymentRequestRoutes.POST("/create", paymentRequestHandler.Create)
+	paymentRequestRoutes.GET("/incoming", paymentRequestHandler.Incoming)
+	paymentRequestRoutes.GET("/outgoing", paymentRequestHandler.Outgoing)
+	paymentRequestRoutes.POST("/accept/:id", paymentRequestHandler.Accept)
+	paymentRequestRoutes.POST("/decline/:id", paymentRequestHandler.Decline)
+	paymentRequestRoutes.POST("/cancel/:id", paymentRequestHandler.Cancel)
+
+	billGroupHandler := handler.NewBillGroup(db)
+	billGroupRoutes := r.Group("/bill-group", middleware.AuthMiddleware(signingKey))
+	billGroupRoutes.POST("/create", billGroupHandler.Create)
+	billGroupRoutes.GET("/read/:id", billGroupHandler.Read)
+	billGroupRoutes.GET("/list", billGroupHandler.List)
+	billGroupRoutes.POST("/member/:id", billGroupHandler.AddMember)
+	billGroupRoutes.POST("/join/:id", billGroupHandler.Join)
+	billGroupRoutes.POST("/expense/:id", billGroupHandler.AddExpense)
+	billGroupRoutes.GET("/balance/:id", billGroupHandler.Balance)
+	billGroupRoutes.POST("/settle/:id", billGroupHandler.Settle)
+
+	qrHandler := handler.NewQR(db)
+	qrRoutes := r.Group("/qr", middleware.AuthMiddleware(signingKey))
+	qrRoutes.POST("/generate", qrHandler.Generate)
+	qrRoutes.POST("/pay", qrHandler.Pay)
+
+	pocketHandler := handler.NewPocket(db)
+	pocketRoutes := r.Group("/pocket", middleware.AuthMiddleware(signingKey))
+	pocketRoutes.POST("/create", pocketHandler.Create)
+	pocketRoutes.GET("/read/:id", pocketHandler.Read)
+	pocketRoutes.PATCH("/update/:id", pocketHandler.Update)
+	pocketRoutes.DELETE("/delete/:id", pocketHandler.Delete)
+	pocketRoutes.GET("/list", pocketHandler.List)
+	pocketRoutes.POST("/deposit/:id", pocketHandler.Deposit)
+	pocketRoutes.POST("/withdraw/:id", pocketHandler.Withdraw)
+
+	productHandler := handler.NewProduct(db)
+	productRoutes := r.Group("/product", middleware.AuthMiddleware(signingKey))
+	productRoutes.POST("/create", middleware.AdminMiddleware(), productHandler.Create)
+	productRoutes.GET("/list", productHandler.List)
+	productRoutes.POST("/assign", middleware.AdminMiddleware(), productHandler.Assign)
+	accountRoutes.GET("/interest", middleware.AuthMiddleware(signingKey), productHandler.Interest)
+
+	feeHandler := handler.NewFee(db)
+	feeRoutes := r.Group("/fee", middleware.AuthMiddleware(signingKey))
+	feeRoutes.POST("/upsert", middleware.AdminMiddleware(), feeHandler.Upsert)
+	feeRoutes.GET("/list", feeHandler.List)
+	feeRoutes.DELETE("/delete/:id", middleware.AdminMiddleware(), feeHandler.Delete)
+	feeRoutes.GET("/quote", feeHandler.Quote)
+	feeRoutes.POST("/tier/:id", middleware.AdminMiddleware(), feeHandler.SetTier)
+
+	cashHandler := handler.NewCash(db)
+	cashRoutes := r.Group("/cash", middleware.AuthMiddleware(signingKey))
+	cashRoutes.POST("/withdraw", cashHandler.Withdraw)
+	cashRoutes.GET("/withdrawal/list", cashHandler.Withdrawals)
+	cashRoutes.POST("/withdrawal/cancel/:id", cashHandler.Cancel)
+	cashRoutes.POST("/redeem", cashHandler.Redeem)
+	cashRoutes.POST("/deposit", cashHandler.Deposit)
+	cashRoutes.POST("/agent/:id", middleware.AdminMiddleware(), cashHandler.SetAgent)
+
+	// Outbound transfers park the money in this account until the rail
+	// settles. Leaving it unset disables them, a wrong value stops startup
+	var clearingAccountID int64
+	if value := os.Getenv("CLEARING_ACCOUNT_ID"); value != "" {
+		clearingAccountID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid CLEARING_ACCOUNT_ID %q: %v", value, err)
+		}
+		if err := db.First(&model.Account{}, "account_id = ?", clearingAccountID).Error; err != nil {
+			log.Fatalf("clearing account %d: %v", clearingAccountID, err)
+		}
+	}
+	paymentRail := rail.NewSimulator(5 * time.Second)
+	paymentRail.Log = log.Printf
+	externalTransferHandler := handler.NewExternalTransfer(db, paymentRail, clearingAccountID)
+	externalTransferRoutes := r.Group("/external-transfer", middleware.AuthMiddleware(signingKey))
+	externalTransferRoutes.POST("/create", externalTransferHandler.Create)
+	externalTransferRoutes.GET("/read/:id", externalTransferHandler.Read)
+	externalTransferRoutes.GET("/list", externalTransferHandler.List)
+
+	// Top-ups are paid through the gateway. The bundled fake one lets anyone
+	// pay a checkout, so it is only wired when explicitly asked for
+	gatewaySecret := []byte(os.Getenv("GATEWAY_SECRET"))
+	if len(gatewaySecret) == 0 {
+		log.Fatal("GATEWAY_SECRET is not set")
+	}
+	fakeGateway := os.Getenv("FAKE_GATEWAY") == "true"
+	var paymentGateway gateway.Gateway
+	if fakeGateway {
+		log.Println("using the fake payment gateway, do not use in production")
+		paymentGateway = gateway.NewFake(gatewaySecret, "http://localhost:8081/topup/webhook")
+	} else {
+		log.Fatal("no payment gateway configured, set FAKE_GATEWAY=true to use the fake one for development")
+	}
+	topUpHandler := handler.NewTopUp(db, paymentGateway, gatewaySecret)
+	accountRoutes.POST("/topup", middleware.AuthMiddleware(signingKey), topUpHandler.Create)
+	accountRoutes.GET("/topup/:id", middleware.AuthMiddleware(signingKey), topUpHandler.Read)
+	r.POST("/topup/webhook", topUpHandler.Webhook)
+	if fakeGateway {
+		r.POST("/fake-gateway/pay/:reference", topUpHandler.FakePay)
+	}
+
+	statementHandler := handler.NewStatement(db)
+	statementRoutes := r.Group("/statement", middleware.AuthMiddleware(signingKey))
+	statementRoutes.GET("/list", statementHandler.List)
+	statementRoutes.GET("/download/:id", statementHandler.Download)
+
+	scheduleHandler := handler.NewSchedule(db)
+	scheduleRoutes := r.Group("/schedule", middleware.AuthMiddleware(signingKey))
+	scheduleRoutes.POST("/create", scheduleHandler.Create)
+	scheduleRoutes.GET("/list", scheduleHandler.List)
+	scheduleRoutes.POST("/cancel/:id", scheduleHandler.Cancel)
+	scheduleRoutes.GET("/history/:id", scheduleHandler.History)
+
+	// Background workers
+	runEvery("hold expiry", time.Minute, func() error {
+		expired, err := holdHandler.ExpireStale()
+		if expired > 0 {
+			log.Printf("expired %d stale holds\n", expired)
+		}
+		return err
+	})
+	runEvery("payment request expiry", time.Minute, func() error {
+		expired, err := paymentRequestHandler.ExpireStale()
+		if expired > 0 {
+			log.Printf("expired %d payment requests\n", expired)
+		}
+		return err
+	})
+	runEvery("cash withdrawal expiry", time.Minute, func() error {
+		expired, err := cashHandler.ExpireStale()
+		if expired > 0 {
+			log.Printf("expired %d cash withdrawals\n", expired)
+		}
+		return err
+	})
+	runEvery("external transfer submission", 10*time.Second, func() error {
+		submitted, err := externalTransferHandler.SubmitPending()
+		if submitted > 0 {
+			log.Printf("submitted %d external transfers\n", submitted)
+		}
+		return err
+	})
+	runEvery("top-up expiry", time.Minute, func() error {
+		expired, err := topUpHandler.ExpireStale()
+		if expired > 0 {
+			log.Printf("expired %d top-ups\n", expired)
+		}
+		return err
+	})
+	runEvery("month-end statements", time.Hour, func() error {
+		generated, err := statementHandler.RunMonthEnd(time.Now())
+		if generated > 0 {
+			log.Printf("generated %d statements\n", generated)
+		}
+		return err
+	})
+	runEvery("interest", time.Hour, func() error {
+		return productHandler.RunInterest(time.Now())
+	})
+	runEvery("scheduled transfers", time.Minute, func() error {
+		attempted, err := scheduleHandler.RunDue()
+		if attempted > 0 {
+			log.Printf("ran %d scheduled transfers\n", attempted)
+		}
+		return err
+	})
 
 	r.Run(":8081") 
 }
 
+// runEvery runs job in the background on every tick of interval.
+func runEvery(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := job(); err != nil {
+				log.Printf("%s job failed: %v\n", name, err)
+			}
+		}
+	}()
+}
+
 func NewDatabase() *gorm.DB {
 	// dsn := "host=localhost port=5432 user=postgres dbname=digi sslmode=disable TimeZone=Asia/Jakarta"
 	dsn := os.Getenv("DATABASE")
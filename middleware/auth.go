@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"errors"
+	"godb/model"
 	"net/http"
 	"strings"
 
@@ -53,6 +54,9 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			if accountID, ok := claims["account_id"].(float64); ok {
 				c.Set("account_id", int64(accountID))
 			}
+			if role, ok := claims["role"].(string); ok {
+				c.Set("role", role)
+			}
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: invalid claims"})
 			c.Abort()
@@ -63,3 +67,16 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware hanya meloloskan token dengan role admin, dipasang setelah AuthMiddleware
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != model.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: admin only"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
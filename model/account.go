@@ -1,9 +1,19 @@
 package model
 
+import "time"
+
 type Account struct {
-	AccountID int64  `json:"account_id" gorm:"primaryKey;autoIncrement;<-:false"`
-	Name      string `json:"name"`
-	Balance   int64  `json:"balance"`
+	AccountID         int64      `json:"account_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Name              string     `json:"name"`
+	Balance           int64      `json:"balance"`
+	HeldBalance       int64      `json:"held_balance"`
+	ProductID         *int64     `json:"product_id"`
+	ProductAssignedAt *time.Time `json:"product_assigned_at"`
+	AccruedInterest   float64    `json:"accrued_interest"`
+	Tier              string     `json:"tier" gorm:"default:basic"`
+	IsAgent           bool       `json:"is_agent"`
+	Timezone          string     `json:"timezone" gorm:"default:Asia/Jakarta"`
+	CreatedAt         time.Time  `json:"created_at"`
 }
 
 // func (Account) TableName() string {
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+)
+
+// Tag is a label an account gives its own transactions.
+type Tag struct {
+	TagID     int64  `json:"tag_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+}
+
+// TransactionTag links a transaction to a tag. Both sides of a transfer can
+// tag it, each with its own tags.
+type TransactionTag struct {
+	TransactionID int64 `json:"transaction_id" gorm:"primaryKey"`
+	TagID         int64 `json:"tag_id" gorm:"primaryKey"`
+}
+
+// TransactionNote is the private note of one account about a transaction.
+type TransactionNote struct {
+	TransactionID int64     `json:"transaction_id" gorm:"primaryKey"`
+	AccountID     int64     `json:"account_id" gorm:"primaryKey"`
+	Note          string    `json:"note"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Attachment is a receipt uploaded by an account for a transaction. The
+// file itself lives in the blob store under StorageKey.
+type Attachment struct {
+	AttachmentID  int64     `json:"attachment_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	TransactionID int64     `json:"transaction_id"`
+	AccountID     int64     `json:"account_id"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	StorageKey    string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -5,8 +5,15 @@ type Auth struct {
 	AccountID int64 `json:"accouunt_id"`
 	Username  string `json:"username"`
 	Password  string `json:"password"`
+	Role      string `json:"role" gorm:"default:user"`
 }
 
+// Roles stored in auths.role and carried in the JWT.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 func (Auth) TableName() string {
 	return "auths"
 }
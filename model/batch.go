@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+)
+
+// Batch modes
+const (
+	BatchModeAllOrNothing = "all_or_nothing"
+	BatchModeBestEffort   = "best_effort"
+)
+
+// Batch and batch item statuses
+const (
+	BatchStatusProcessing = "processing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusPartial    = "partially_completed"
+	BatchStatusFailed     = "failed"
+
+	BatchItemStatusPending = "pending"
+	BatchItemStatusSuccess = "success"
+	BatchItemStatusFailed  = "failed"
+)
+
+// TransferBatch groups many transfers sent from one account in one upload.
+type TransferBatch struct {
+	BatchID         int64               `json:"batch_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID       int64               `json:"account_id"`
+	Mode            string              `json:"mode"`
+	Status          string              `json:"status"`
+	TotalItems      int                 `json:"total_items"`
+	SucceededItems  int                 `json:"succeeded_items"`
+	FailedItems     int                 `json:"failed_items"`
+	TotalAmount     int64               `json:"total_amount"`
+	SucceededAmount int64               `json:"succeeded_amount"`
+	CreatedAt       time.Time           `json:"created_at"`
+	CompletedAt     *time.Time          `json:"completed_at"`
+	Items           []TransferBatchItem `json:"items,omitempty" gorm:"foreignKey:BatchID"`
+}
+
+// TransferBatchItem is one line of a TransferBatch.
+type TransferBatchItem struct {
+	ItemID                int64  `json:"item_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BatchID               int64  `json:"batch_id"`
+	Line                  int    `json:"line"`
+	ToAccountID           int64  `json:"to_account_id"`
+	Amount                int64  `json:"amount"`
+	TransactionCategoryID *int64 `json:"transaction_category_id"`
+	Status                string `json:"status"`
+	Error                 string `json:"error"`
+	TransactionID         *int64 `json:"transaction_id"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// Beneficiary is a saved payee in the address book of AccountID.
+type Beneficiary struct {
+	BeneficiaryID   int64     `json:"beneficiary_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID       int64     `json:"account_id"`
+	TargetAccountID int64     `json:"target_account_id"`
+	Nickname        string    `json:"nickname"`
+	VerifiedName    string    `json:"verified_name"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+)
+
+// Expense split types
+const (
+	SplitEqual      = "equal"
+	SplitPercentage = "percentage"
+	SplitExact      = "exact"
+)
+
+// Bill group member statuses
+const (
+	MemberInvited = "invited"
+	MemberJoined  = "joined"
+)
+
+// BillGroup is a group of accounts sharing expenses, e.g. a trip.
+type BillGroup struct {
+	BillGroupID        int64             `json:"bill_group_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Name               string            `json:"name"`
+	CreatedByAccountID int64             `json:"created_by_account_id"`
+	CreatedAt          time.Time         `json:"created_at"`
+	Members            []BillGroupMember `json:"members,omitempty" gorm:"foreignKey:BillGroupID"`
+}
+
+// BillGroupMember is an account invited to a group. Only members that
+// accepted the invitation take part in expenses and settlements.
+type BillGroupMember struct {
+	BillGroupID int64      `json:"bill_group_id" gorm:"primaryKey"`
+	AccountID   int64      `json:"account_id" gorm:"primaryKey"`
+	Status      string     `json:"status"`
+	JoinedAt    *time.Time `json:"joined_at"`
+}
+
+// BillExpense is paid by one member and shared by some members of a group.
+type BillExpense struct {
+	BillExpenseID   int64              `json:"bill_expense_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BillGroupID     int64              `json:"bill_group_id"`
+	PaidByAccountID int64              `json:"paid_by_account_id"`
+	Description     string             `json:"description"`
+	Amount          int64              `json:"amount"`
+	SplitType       string             `json:"split_type"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Shares          []BillExpenseShare `json:"shares,omitempty" gorm:"foreignKey:BillExpenseID"`
+}
+
+// BillExpenseShare is the part of an expense owed by one member.
+type BillExpenseShare struct {
+	BillExpenseID int64 `json:"bill_expense_id" gorm:"primaryKey"`
+	AccountID     int64 `json:"account_id" gorm:"primaryKey"`
+	Amount        int64 `json:"amount"`
+}
+
+// BillSettlement is a transfer made to pay back debts inside a group.
+type BillSettlement struct {
+	BillSettlementID int64     `json:"bill_settlement_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	BillGroupID      int64     `json:"bill_group_id"`
+	FromAccountID    int64     `json:"from_account_id"`
+	ToAccountID      int64     `json:"to_account_id"`
+	Amount           int64     `json:"amount"`
+	TransactionID    int64     `json:"transaction_id"`
+	CreatedAt        time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// Cash withdrawal statuses
+const (
+	CashWithdrawalPending   = "pending"
+	CashWithdrawalRedeemed  = "redeemed"
+	CashWithdrawalCancelled = "cancelled"
+	CashWithdrawalExpired   = "expired"
+)
+
+// CashWithdrawal reserves Amount of an account until an agent pays it out
+// in cash against the one-time code. Only a hash of the code is stored.
+type CashWithdrawal struct {
+	CashWithdrawalID int64      `json:"cash_withdrawal_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID        int64      `json:"account_id"`
+	Amount           int64      `json:"amount"`
+	CodeHash         string     `json:"-"`
+	Status           string     `json:"status"`
+	AgentAccountID   *int64     `json:"agent_account_id"`
+	TransactionID    *int64     `json:"transaction_id"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RedeemedAt       *time.Time `json:"redeemed_at"`
+}
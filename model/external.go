@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// External transfer statuses. A transfer is pending until it is handed to the
+// payment rail, then submitted until the rail reports the outcome.
+const (
+	ExternalTransferPending   = "pending"
+	ExternalTransferSubmitted = "submitted"
+	ExternalTransferCompleted = "completed"
+	ExternalTransferFailed    = "failed"
+)
+
+// ExternalTransfer sends Amount from an account to an account at another
+// bank. Until it completes the money sits in the clearing account.
+type ExternalTransfer struct {
+	ExternalTransferID      int64     `json:"external_transfer_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID               int64     `json:"account_id"`
+	BankCode                string    `json:"bank_code"`
+	AccountNumber           string    `json:"account_number"`
+	AccountName             string    `json:"account_name"`
+	Amount                  int64     `json:"amount"`
+	Status                  string    `json:"status"`
+	RailReference           string    `json:"rail_reference"`
+	FailureReason           string    `json:"failure_reason"`
+	TransactionID           int64     `json:"transaction_id"`
+	SettlementTransactionID *int64    `json:"settlement_transaction_id"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+// Operations fees can be charged on
+const (
+	FeeOperationTransfer = "transfer"
+	FeeOperationTopUp    = "topup"
+)
+
+// Name of the system transaction category fees are posted with.
+const CategoryFee = "Fee"
+
+// Default tier of an account
+const TierBasic = "basic"
+
+// FeeRule is the fee charged on Operation for accounts of Tier, paid into
+// RevenueAccountID. Percent is in percent of the amount; the first
+// FreePerMonth operations of a calendar month are free.
+type FeeRule struct {
+	FeeRuleID        int64     `json:"fee_rule_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Operation        string    `json:"operation"`
+	Tier             string    `json:"tier"`
+	FlatFee          int64     `json:"flat_fee"`
+	Percent          float64   `json:"percent"`
+	MinFee           int64     `json:"min_fee"`
+	MaxFee           *int64    `json:"max_fee"`
+	FreePerMonth     int       `json:"free_per_month"`
+	RevenueAccountID int64     `json:"revenue_account_id"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// FeeUsage counts the fee-eligible operations of an account in a month
+// (Period is formatted as 2006-01).
+type FeeUsage struct {
+	AccountID int64  `json:"account_id" gorm:"primaryKey"`
+	Operation string `json:"operation" gorm:"primaryKey"`
+	Period    string `json:"period" gorm:"primaryKey"`
+	Count     int    `json:"count"`
+}
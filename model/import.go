@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// ImportedTransaction remembers the fingerprint of every imported CSV row so
+// importing the same file twice does not duplicate the history.
+type ImportedTransaction struct {
+	AccountID     int64     `json:"account_id" gorm:"primaryKey"`
+	Fingerprint   string    `json:"fingerprint" gorm:"primaryKey"`
+	TransactionID int64     `json:"transaction_id"`
+	ImportedAt    time.Time `json:"imported_at"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// Payment request statuses
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestAccepted  = "accepted"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestCancelled = "cancelled"
+	PaymentRequestExpired   = "expired"
+)
+
+// PaymentRequest asks PayerAccountID to send Amount to RequesterAccountID.
+type PaymentRequest struct {
+	PaymentRequestID   int64      `json:"payment_request_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	RequesterAccountID int64      `json:"requester_account_id"`
+	PayerAccountID     int64      `json:"payer_account_id"`
+	Amount             int64      `json:"amount"`
+	Note               string     `json:"note"`
+	Status             string     `json:"status"`
+	TransactionID      *int64     `json:"transaction_id"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	RespondedAt        *time.Time `json:"responded_at"`
+}
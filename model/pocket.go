@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// Auto-save rules of a pocket
+const (
+	AutoSaveNone    = ""
+	AutoSaveFixed   = "fixed"
+	AutoSaveRoundUp = "roundup"
+)
+
+// Pocket is money of an account set aside for a goal. Its balance is not
+// part of the account balance.
+type Pocket struct {
+	PocketID       int64      `json:"pocket_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID      int64      `json:"account_id"`
+	Name           string     `json:"name"`
+	Balance        int64      `json:"balance"`
+	TargetAmount   *int64     `json:"target_amount"`
+	TargetDate     *time.Time `json:"target_date"`
+	AutoSaveType   string     `json:"auto_save_type"`
+	AutoSaveAmount int64      `json:"auto_save_amount"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+}
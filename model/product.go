@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+// Day-count conventions for interest
+const (
+	DayCountActual365 = "ACT/365"
+	DayCountActual360 = "ACT/360"
+	DayCount30360     = "30/360"
+)
+
+// Name of the system transaction category interest is posted with.
+const CategoryInterest = "Interest"
+
+// AccountProduct is a savings product an account can be assigned to.
+type AccountProduct struct {
+	ProductID int64             `json:"product_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Name      string            `json:"name"`
+	DayCount  string            `json:"day_count"`
+	CreatedAt time.Time         `json:"created_at"`
+	Tiers     []ProductRateTier `json:"tiers" gorm:"foreignKey:ProductID"`
+}
+
+// ProductRateTier applies AnnualRate (in percent) to the part of the balance
+// from MinBalance up to the MinBalance of the next tier.
+type ProductRateTier struct {
+	TierID     int64   `json:"tier_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	ProductID  int64   `json:"product_id"`
+	MinBalance int64   `json:"min_balance"`
+	AnnualRate float64 `json:"annual_rate"`
+}
+
+// InterestAccrual is the interest earned by an account on one day.
+type InterestAccrual struct {
+	AccrualID     int64     `json:"accrual_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID     int64     `json:"account_id"`
+	AccrualDate   time.Time `json:"accrual_date"`
+	Balance       int64     `json:"balance"`
+	Amount        float64   `json:"amount"`
+	TransactionID *int64    `json:"transaction_id"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+)
+
+// Schedule frequencies
+const (
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Schedule statuses
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// Execution statuses
+const (
+	ExecutionStatusSuccess  = "success"
+	ExecutionStatusRetrying = "retrying"
+	ExecutionStatusFailed   = "failed"
+)
+
+// ScheduledTransfer is a standing order that sends money from AccountID to
+// ToAccountID once or on every occurrence of Frequency, starting at StartAt.
+type ScheduledTransfer struct {
+	ScheduledTransferID   int64      `json:"scheduled_transfer_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID             int64      `json:"account_id"`
+	ToAccountID           int64      `json:"to_account_id"`
+	TransactionCategoryID *int64     `json:"transaction_category_id"`
+	Amount                int64      `json:"amount"`
+	Frequency             string     `json:"frequency"`
+	StartAt               time.Time  `json:"start_at"`
+	EndDate               *time.Time `json:"end_date"`
+	MaxOccurrences        *int       `json:"max_occurrences"`
+	Occurrences           int        `json:"occurrences"`
+	RetryCount            int        `json:"retry_count"`
+	NextRunAt             *time.Time `json:"next_run_at"`
+	Status                string     `json:"status"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// ScheduledTransferExecution is one attempt to run a ScheduledTransfer.
+type ScheduledTransferExecution struct {
+	ExecutionID         int64     `json:"execution_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	ScheduledTransferID int64     `json:"scheduled_transfer_id"`
+	TransactionID       *int64    `json:"transaction_id"`
+	Occurrence          int       `json:"occurrence"`
+	Attempt             int       `json:"attempt"`
+	Status              string    `json:"status"`
+	Error               string    `json:"error"`
+	ExecutedAt          time.Time `json:"executed_at"`
+}
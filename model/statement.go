@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// Statement is the monthly statement of an account. The PDF is generated
+// once by the month-end job and stored as is.
+type Statement struct {
+	StatementID     int64     `json:"statement_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID       int64     `json:"account_id"`
+	StatementNumber string    `json:"statement_number"`
+	Period          string    `json:"period"`
+	PeriodStart     time.Time `json:"period_start"`
+	PeriodEnd       time.Time `json:"period_end"`
+	OpeningBalance  int64     `json:"opening_balance"`
+	ClosingBalance  int64     `json:"closing_balance"`
+	TotalIn         int64     `json:"total_in"`
+	TotalOut        int64     `json:"total_out"`
+	Content         []byte    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+}
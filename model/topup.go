@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// Top-up intent statuses
+const (
+	TopUpIntentPending = "pending"
+	TopUpIntentPaid    = "paid"
+	TopUpIntentFailed  = "failed"
+	TopUpIntentExpired = "expired"
+)
+
+// TopUpIntent is a top-up waiting for the payment gateway. The account is
+// only credited when the gateway confirms the payment.
+type TopUpIntent struct {
+	TopUpIntentID     int64      `json:"top_up_intent_id" gorm:"primaryKey;autoIncrement;<-:false"`
+	AccountID         int64      `json:"account_id"`
+	Amount            int64      `json:"amount"`
+	Status            string     `json:"status"`
+	CheckoutReference string     `json:"checkout_reference"`
+	CheckoutURL       string     `json:"checkout_url"`
+	TransactionID     *int64     `json:"transaction_id"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	PaidAt            *time.Time `json:"paid_at"`
+}
+
+// GatewayEvent records a processed webhook so a replay is ignored.
+type GatewayEvent struct {
+	EventID    string    `json:"event_id" gorm:"primaryKey"`
+	Type       string    `json:"type"`
+	ReceivedAt time.Time `json:"received_at"`
+}
@@ -4,6 +4,32 @@ import (
     "time"
 )
 
+// Transaction statuses. A plain transfer is completed as soon as it is
+// inserted, a hold starts as authorized and ends captured, voided or expired.
+const (
+    TransactionStatusCompleted  = "completed"
+    TransactionStatusAuthorized = "authorized"
+    TransactionStatusCaptured   = "captured"
+    TransactionStatusVoided     = "voided"
+    TransactionStatusExpired    = "expired"
+)
+
+// Transaction types. Every posting has one; the fields a type needs are
+// checked by the transaction handler.
+const (
+    TransactionTypeTopUp            = "topup"
+    TransactionTypeTransfer         = "transfer"
+    TransactionTypeFee              = "fee"
+    TransactionTypeInterest         = "interest"
+    TransactionTypeReversal         = "reversal"
+    TransactionTypeAdjustment       = "adjustment"
+    TransactionTypeWithdrawal       = "withdrawal"
+    TransactionTypeDeposit          = "deposit"
+    TransactionTypeExternalTransfer = "external_transfer"
+    TransactionTypeImport           = "import"
+    TransactionTypePocket           = "pocket"
+)
+
 type Transaction struct {
     TransactionID        int64     `gorm:"primaryKey;autoIncrement" json:"transaction_id"`
     TransactionCategoryID *int64    `json:"transaction_category_id"` // Adjusted for nullable foreign key
@@ -12,10 +38,20 @@ type Transaction struct {
     ToAccountID          *int64    `json:"to_account_id"`
     Amount               int64     `json:"amount"`
     TransactionDate      time.Time `json:"transaction_date"`
+    Status               string     `json:"status" gorm:"default:completed"`
+    HoldAmount           int64      `json:"hold_amount,omitempty"`
+    // FundsHeld is set while HoldAmount is reserved in the held balance of
+    // the payer, which only holdFunds does
+    FundsHeld            bool       `json:"-"`
+    ExpiresAt            *time.Time `json:"expires_at,omitempty"`
+    RelatedTransactionID *int64     `json:"related_transaction_id,omitempty"`
+    RefundedAmount       int64      `json:"refunded_amount"`
+    PocketID             *int64     `json:"pocket_id,omitempty"`
+    Type                 string     `json:"type"`
+    Description          string     `json:"description"`
 }
 
 
 func (Transaction) TableName() string {
     return "transaction" 
 }
-
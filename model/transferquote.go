@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// UsedTransferQuote records that a signed transfer quote was executed, so
+// the same quote cannot be executed twice.
+type UsedTransferQuote struct {
+	QuoteID       string    `json:"quote_id" gorm:"primaryKey"`
+	AccountID     int64     `json:"account_id"`
+	TransactionID int64     `json:"transaction_id"`
+	UsedAt        time.Time `json:"used_at"`
+}
@@ -0,0 +1,257 @@
+// Package qris encodes and decodes EMVCo merchant-presented QR payloads in
+// the QRIS style used to receive money into an account.
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Identifier in the merchant account information template of our payloads.
+const GloballyUniqueID = "ID.GODB.WWW"
+
+// Top level tags of the payload
+const (
+	tagFormatIndicator     = "00"
+	tagInitiationMethod    = "01"
+	tagMerchantAccount     = "26"
+	tagMerchantCategory    = "52"
+	tagCurrency            = "53"
+	tagAmount              = "54"
+	tagCountry             = "58"
+	tagMerchantName        = "59"
+	tagMerchantCity        = "60"
+	tagAdditionalData      = "62"
+	tagCRC                 = "63"
+	subTagGloballyUniqueID = "00"
+	subTagAccountID        = "01"
+	subTagReference        = "05"
+)
+
+const (
+	initiationStatic  = "11"
+	initiationDynamic = "12"
+	currencyIDR       = "360"
+
+	// maxReferenceLength is the most characters EMVCo allows in a reference.
+	maxReferenceLength = 25
+)
+
+var (
+	ErrInvalidPayload = errors.New("invalid QR payload")
+	ErrInvalidCRC     = errors.New("QR payload checksum mismatch")
+)
+
+// Payment is the content of a payload. An Amount of 0 makes a static code
+// where the payer enters the amount.
+type Payment struct {
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+	City      string `json:"city"`
+	Amount    int64  `json:"amount"`
+	Reference string `json:"reference"`
+}
+
+// Encode builds the payload string for p, ending with its CRC.
+func Encode(p Payment) (string, error) {
+	if p.AccountID <= 0 {
+		return "", fmt.Errorf("%w: account id is required", ErrInvalidPayload)
+	}
+	if p.Amount < 0 {
+		return "", fmt.Errorf("%w: amount must not be negative", ErrInvalidPayload)
+	}
+	// Unlike the name, a cut off reference would no longer match the payment
+	reference := strings.TrimSpace(p.Reference)
+	if utf8.RuneCountInString(reference) > maxReferenceLength {
+		return "", fmt.Errorf("%w: reference is longer than %d characters", ErrInvalidPayload, maxReferenceLength)
+	}
+
+	var b tlvWriter
+	method := initiationStatic
+	if p.Amount > 0 {
+		method = initiationDynamic
+	}
+
+	b.write(tagFormatIndicator, "01")
+	b.write(tagInitiationMethod, method)
+
+	var account tlvWriter
+	account.write(subTagGloballyUniqueID, GloballyUniqueID)
+	account.write(subTagAccountID, strconv.FormatInt(p.AccountID, 10))
+	b.writeTemplate(tagMerchantAccount, &account)
+
+	b.write(tagMerchantCategory, "0000")
+	b.write(tagCurrency, currencyIDR)
+	if p.Amount > 0 {
+		b.write(tagAmount, strconv.FormatInt(p.Amount, 10))
+	}
+	b.write(tagCountry, "ID")
+	b.write(tagMerchantName, MerchantName(p.Name))
+	b.write(tagMerchantCity, truncate(p.City, 15))
+
+	if reference != "" {
+		var additional tlvWriter
+		additional.write(subTagReference, reference)
+		b.writeTemplate(tagAdditionalData, &additional)
+	}
+	if b.err != nil {
+		return "", b.err
+	}
+
+	// The checksum covers everything up to and including its own tag and length
+	b.b.WriteString(tagCRC + "04")
+	b.b.WriteString(fmt.Sprintf("%04X", CRC16(b.b.String())))
+
+	return b.b.String(), nil
+}
+
+// Decode parses and validates a payload produced by Encode.
+func Decode(payload string) (Payment, error) {
+	var p Payment
+
+	if len(payload) < 8 || payload[len(payload)-8:len(payload)-4] != tagCRC+"04" {
+		return p, fmt.Errorf("%w: missing checksum", ErrInvalidPayload)
+	}
+	expected := fmt.Sprintf("%04X", CRC16(payload[:len(payload)-4]))
+	if !strings.EqualFold(expected, payload[len(payload)-4:]) {
+		return p, ErrInvalidCRC
+	}
+
+	fields, err := parseTLV(payload[:len(payload)-8])
+	if err != nil {
+		return p, err
+	}
+
+	if fields[tagFormatIndicator] != "01" {
+		return p, fmt.Errorf("%w: unsupported payload format", ErrInvalidPayload)
+	}
+	if fields[tagCurrency] != currencyIDR {
+		return p, fmt.Errorf("%w: unsupported currency", ErrInvalidPayload)
+	}
+
+	account, err := parseTLV(fields[tagMerchantAccount])
+	if err != nil {
+		return p, err
+	}
+	if account[subTagGloballyUniqueID] != GloballyUniqueID {
+		return p, fmt.Errorf("%w: not a payload of this service", ErrInvalidPayload)
+	}
+	p.AccountID, err = strconv.ParseInt(account[subTagAccountID], 10, 64)
+	if err != nil || p.AccountID <= 0 {
+		return p, fmt.Errorf("%w: invalid account id", ErrInvalidPayload)
+	}
+
+	if amount, ok := fields[tagAmount]; ok {
+		p.Amount, err = strconv.ParseInt(amount, 10, 64)
+		if err != nil || p.Amount <= 0 {
+			return p, fmt.Errorf("%w: invalid amount", ErrInvalidPayload)
+		}
+	}
+	if fields[tagInitiationMethod] == initiationDynamic && p.Amount == 0 {
+		return p, fmt.Errorf("%w: dynamic payload without amount", ErrInvalidPayload)
+	}
+
+	p.Name = fields[tagMerchantName]
+	p.City = fields[tagMerchantCity]
+
+	if additional, ok := fields[tagAdditionalData]; ok {
+		data, err := parseTLV(additional)
+		if err != nil {
+			return p, err
+		}
+		p.Reference = data[subTagReference]
+	}
+
+	return p, nil
+}
+
+// CRC16 is the CRC-16/CCITT-FALSE checksum required by EMVCo.
+func CRC16(data string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// maxFieldLength is the most bytes the two digit length of a field allows.
+const maxFieldLength = 99
+
+// tlvWriter writes tag, length, value fields, keeping the first error.
+type tlvWriter struct {
+	b   strings.Builder
+	err error
+}
+
+func (w *tlvWriter) write(tag, value string) {
+	if w.err != nil {
+		return
+	}
+	if len(value) > maxFieldLength {
+		w.err = fmt.Errorf("%w: field %s is longer than %d bytes", ErrInvalidPayload, tag, maxFieldLength)
+		return
+	}
+	w.b.WriteString(tag)
+	w.b.WriteString(fmt.Sprintf("%02d", len(value)))
+	w.b.WriteString(value)
+}
+
+// writeTemplate writes the fields of inner as the value of tag.
+func (w *tlvWriter) writeTemplate(tag string, inner *tlvWriter) {
+	if w.err == nil {
+		w.err = inner.err
+	}
+	w.write(tag, inner.b.String())
+}
+
+func parseTLV(data string) (map[string]string, error) {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%w: truncated field", ErrInvalidPayload)
+		}
+		// The length is exactly two digits, so it is never negative
+		if !isDigit(data[2]) || !isDigit(data[3]) {
+			return nil, fmt.Errorf("%w: invalid length of field %s", ErrInvalidPayload, data[:2])
+		}
+		length := int(data[2]-'0')*10 + int(data[3]-'0')
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("%w: invalid length of field %s", ErrInvalidPayload, data[:2])
+		}
+		fields[data[:2]] = data[4 : 4+length]
+		data = data[4+length:]
+	}
+	return fields, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// MerchantName is name as it is stored in a payload.
+func MerchantName(name string) string {
+	return truncate(name, 25)
+}
+
+// truncate keeps at most n characters, as EMVCo limits field lengths, and
+// at most maxFieldLength bytes without splitting a character.
+func truncate(s string, n int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	for len(string(runes)) > maxFieldLength {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
@@ -0,0 +1,156 @@
+package qris
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// withCRC appends a valid checksum to body.
+func withCRC(body string) string {
+	body += tagCRC + "04"
+	return body + fmt.Sprintf("%04X", CRC16(body))
+}
+
+func TestCRC16(t *testing.T) {
+	// Check value of CRC-16/CCITT-FALSE
+	if got := CRC16("123456789"); got != 0x29B1 {
+		t.Errorf("CRC16 = %04X, want 29B1", got)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, p := range []Payment{
+		{AccountID: 42, Name: "Budi Santoso", City: "Jakarta"},
+		{AccountID: 7, Name: "Siti", City: "Bandung", Amount: 150000, Reference: "INV-2026-0001"},
+		{AccountID: 9, Name: "Kopi Kenangan Senja", City: "Yogyakarta", Amount: 1, Reference: strings.Repeat("é", 25)},
+	} {
+		payload, err := Encode(p)
+		if err != nil {
+			t.Fatalf("Encode(%+v): %v", p, err)
+		}
+
+		wantMethod := tagInitiationMethod + "02" + initiationStatic
+		if p.Amount > 0 {
+			wantMethod = tagInitiationMethod + "02" + initiationDynamic
+		}
+		if !strings.HasPrefix(payload, "000201"+wantMethod) {
+			t.Errorf("payload %q does not start with the format and %s", payload, wantMethod)
+		}
+
+		got, err := Decode(payload)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", payload, err)
+		}
+		if got != p {
+			t.Errorf("round trip = %+v, want %+v", got, p)
+		}
+	}
+}
+
+func TestEncodeTruncatesName(t *testing.T) {
+	payload, err := Encode(Payment{
+		AccountID: 1,
+		Name:      "  Perusahaan Dagang Sumber Rejeki Makmur  ",
+		City:      "Kabupaten Tangerang Selatan",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Perusahaan Dagang Sumber " {
+		t.Errorf("name = %q", got.Name)
+	}
+	if got.City != "Kabupaten Tange" {
+		t.Errorf("city = %q", got.City)
+	}
+}
+
+func TestEncodeRejects(t *testing.T) {
+	for name, p := range map[string]Payment{
+		"missing account":      {Name: "Budi"},
+		"negative amount":      {AccountID: 1, Amount: -1},
+		"long reference":       {AccountID: 1, Reference: strings.Repeat("x", 26)},
+		"reference over bytes": {AccountID: 1, Reference: strings.Repeat("😀", 25)},
+	} {
+		if _, err := Encode(p); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: err = %v, want ErrInvalidPayload", name, err)
+		}
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	payload, err := Encode(Payment{AccountID: 42, Name: "Budi", City: "Jakarta", Amount: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lower case hex digits are accepted
+	if _, err := Decode(payload[:len(payload)-4] + strings.ToLower(payload[len(payload)-4:])); err != nil {
+		t.Errorf("lower case checksum: %v", err)
+	}
+
+	tampered := strings.Replace(payload, "54045000", "54049000", 1)
+	if tampered == payload {
+		t.Fatal("amount field not found in payload")
+	}
+	if _, err := Decode(tampered); !errors.Is(err, ErrInvalidCRC) {
+		t.Errorf("tampered amount: err = %v, want ErrInvalidCRC", err)
+	}
+
+	for _, short := range []string{"", "6304", payload[:len(payload)-8]} {
+		if _, err := Decode(short); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("Decode(%q): err = %v, want ErrInvalidPayload", short, err)
+		}
+	}
+}
+
+func TestDecodeMalformedFields(t *testing.T) {
+	for name, body := range map[string]string{
+		"truncated field":   "000201010",
+		"non-numeric":       "0002010102-1",
+		"letter in length":  "00020101a211",
+		"length past data":  "000201010512",
+		"wrong format":      "000202",
+		"foreign currency":  "000201" + "5303840",
+		"foreign id":        "000201" + "2620" + "0011ID.CO.OTHER" + "0101" + "1" + "5303360",
+		"nested truncation": "000201" + "26050011A" + "5303360",
+	} {
+		if _, err := Decode(withCRC(body)); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: err = %v, want ErrInvalidPayload", name, err)
+		}
+	}
+}
+
+func TestFieldLimit(t *testing.T) {
+	var w tlvWriter
+	w.write("01", strings.Repeat("a", maxFieldLength))
+	if w.err != nil {
+		t.Fatalf("%d bytes: %v", maxFieldLength, w.err)
+	}
+	if got := w.b.String(); !strings.HasPrefix(got, "0199") || len(got) != 4+maxFieldLength {
+		t.Errorf("field = %q", got)
+	}
+
+	w.write("02", strings.Repeat("a", maxFieldLength+1))
+	if !errors.Is(w.err, ErrInvalidPayload) {
+		t.Errorf("%d bytes: err = %v, want ErrInvalidPayload", maxFieldLength+1, w.err)
+	}
+
+	// The first error sticks to the template holding the field
+	var outer tlvWriter
+	outer.writeTemplate("62", &w)
+	if !errors.Is(outer.err, ErrInvalidPayload) {
+		t.Errorf("template: err = %v, want ErrInvalidPayload", outer.err)
+	}
+
+	// Truncating keeps whole characters within the byte limit
+	if got := truncate(strings.Repeat("😀", 30), 30); len(got) > maxFieldLength || len(got)%4 != 0 {
+		t.Errorf("truncate kept %d bytes", len(got))
+	}
+}
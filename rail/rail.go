@@ -0,0 +1,83 @@
+// Package rail sends money to accounts at other banks. Each rail, such as a
+// clearing house or a bank API, is an adapter behind PaymentRail.
+package rail
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrInvalidPayout = errors.New("invalid payout")
+
+// Payout is a single outbound transfer. ID is the idempotency key of the
+// payout on the rail.
+type Payout struct {
+	ID            int64
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+	Amount        int64
+}
+
+// Result is the final outcome of a payout.
+type Result struct {
+	PayoutID  int64
+	Reference string
+	Success   bool
+	Reason    string
+}
+
+// Callback receives the result of a payout. It may be called more than once
+// for the same payout and must be idempotent.
+type Callback func(Result) error
+
+// PaymentRail submits payouts. Submit only hands the payout over and returns
+// the reference of the rail; the outcome is reported later through callback.
+// Submitting a payout whose ID was submitted before must not pay it again but
+// return the reference of the first submission, so a caller that lost track
+// of a submission can safely retry it.
+type PaymentRail interface {
+	Submit(p Payout, callback Callback) (reference string, err error)
+}
+
+// Simulator is a local rail that settles every payout after Delay. Payouts to
+// account numbers starting with "999" are rejected as closed accounts.
+type Simulator struct {
+	Delay time.Duration
+	Log   func(format string, args ...any)
+
+	sequence  atomic.Int64
+	submitted sync.Map
+}
+
+func NewSimulator(delay time.Duration) *Simulator {
+	return &Simulator{Delay: delay}
+}
+
+func (s *Simulator) Submit(p Payout, callback Callback) (string, error) {
+	if p.Amount <= 0 || p.BankCode == "" || p.AccountNumber == "" {
+		return "", ErrInvalidPayout
+	}
+
+	reference := fmt.Sprintf("SIM%s%06d", time.Now().Format("20060102"), s.sequence.Add(1))
+	if first, loaded := s.submitted.LoadOrStore(p.ID, reference); loaded {
+		return first.(string), nil
+	}
+	result := Result{PayoutID: p.ID, Reference: reference, Success: true}
+	if strings.HasPrefix(p.AccountNumber, "999") {
+		result.Success = false
+		result.Reason = "account closed"
+	}
+
+	time.AfterFunc(s.Delay, func() {
+		if err := callback(result); err != nil && s.Log != nil {
+			s.Log("rail simulator: callback for %s failed: %v", reference, err)
+		}
+	})
+
+	return reference, nil
+}
@@ -0,0 +1,21 @@
+// Package storage keeps uploaded files, such as receipts, outside the
+// database. Each backend, such as a local directory or an object store, is
+// an adapter behind BlobStore.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore stores blobs under keys made of slash separated segments.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}